@@ -1,16 +1,39 @@
 package main
 
 import (
+	"context"
+	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"gioui.org/app"
 	"gioui.org/op"
 	"github.com/olablt/gio-tiles/mapview"
+	"github.com/olablt/gio-tiles/tiles"
 )
 
 func main() {
 	refresh := make(chan struct{}, 1)
-	mv := mapview.New(refresh)
+
+	// Keep downloaded tiles on disk so that restarts show the map at once
+	opts := tiles.TileManagerOptions{}
+	if dir, err := os.UserCacheDir(); err == nil {
+		disk, err := tiles.NewDiskCache(filepath.Join(dir, "gio-tiles"))
+		if err != nil {
+			log.Printf("disk cache disabled: %v", err)
+		} else {
+			opts.DiskCache = disk
+		}
+	}
+	tm := tiles.NewTileManagerWithOptions(
+		tiles.NewCombinedTileProvider(
+			tiles.NewOSMTileProvider(),
+			tiles.NewLocalTileProvider(),
+		),
+		opts,
+	)
+	mv := mapview.NewWithOptions(refresh, mapview.Options{TileManager: tm})
 	go func() {
 		w := new(app.Window)
 
@@ -23,6 +46,17 @@ func main() {
 		for {
 			switch e := w.Event().(type) {
 			case app.DestroyEvent:
+				mv.Close()
+				// Give running downloads a moment so that they reach the
+				// disk cache, then write out what is pending
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				if err := tm.Shutdown(ctx); err != nil {
+					log.Printf("tile manager shutdown: %v", err)
+				}
+				cancel()
+				if opts.DiskCache != nil {
+					opts.DiskCache.Close()
+				}
 				os.Exit(0)
 			case app.FrameEvent:
 				gtx := app.NewContext(&ops, e)
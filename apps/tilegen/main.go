@@ -0,0 +1,153 @@
+// Command tilegen cuts a georeferenced PNG or JPEG into a z/x/y tile
+// pyramid, written to a directory or an MBTiles file.
+//
+//	tilegen -in plan.png -minzoom 15 -maxzoom 20 -out tiles/
+//	tilegen -in map.jpg -bounds 54.70,25.25,54.67,25.30 -out map.mbtiles
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/olablt/gio-tiles/tiles"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	in := flag.String("in", "", "source PNG or JPEG image")
+	worldFile := flag.String("world", "", "world file, found next to the image when empty")
+	bounds := flag.String("bounds", "", "image corners as north,west,south,east instead of a world file")
+	crs := flag.Int("crs", 4326, "EPSG code of the world file coordinates (4326 or 3857)")
+	minZoom := flag.Int("minzoom", 0, "lowest zoom level")
+	maxZoom := flag.Int("maxzoom", 18, "highest zoom level")
+	out := flag.String("out", "tiles", "output directory, or a .mbtiles file")
+	format := flag.String("format", "png", "tile format, png or jpg")
+	sampling := flag.String("sampling", "bilinear", "resampling, nearest or bilinear")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// MBTiles names the format jpg, and so do tile directories
+	switch *format {
+	case "png", "jpg":
+	case "jpeg":
+		*format = "jpg"
+	default:
+		log.Fatalf("unsupported format %q, use png or jpg", *format)
+	}
+	var sample tiles.Sampling
+	switch *sampling {
+	case "nearest":
+		sample = tiles.SampleNearest
+	case "bilinear":
+		sample = tiles.SampleBilinear
+	default:
+		log.Fatalf("unsupported sampling %q, use nearest or bilinear", *sampling)
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("decoding %s: %v", *in, err)
+	}
+
+	raster := &tiles.GeoRaster{Image: img}
+	if *bounds != "" {
+		b, err := parseBounds(*bounds)
+		if err != nil {
+			log.Fatal(err)
+		}
+		raster.CRS = tiles.EPSG4326
+		raster.Transform = tiles.TransformFromBounds(b, img.Bounds().Dx(), img.Bounds().Dy())
+	} else {
+		path := *worldFile
+		if path == "" {
+			var ok bool
+			if path, ok = tiles.FindWorldFile(*in); !ok {
+				log.Fatalf("no world file found for %s, use -world or -bounds", *in)
+			}
+		}
+		if raster.Transform, err = tiles.ReadWorldFile(path); err != nil {
+			log.Fatal(err)
+		}
+		raster.CRS = tiles.CRS(*crs)
+		if raster.CRS != tiles.EPSG4326 && raster.CRS != tiles.EPSG3857 {
+			log.Fatalf("unsupported CRS EPSG:%d", *crs)
+		}
+	}
+
+	opts := tiles.PyramidOptions{
+		MinZoom:  *minZoom,
+		MaxZoom:  *maxZoom,
+		Sampling: sample,
+		Format:   *format,
+	}
+
+	var w tiles.TileWriter
+	if strings.HasSuffix(*out, ".mbtiles") {
+		db, err := sql.Open("sqlite", *out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		b := raster.Bounds()
+		w, err = tiles.NewMBTilesWriter(db, map[string]string{
+			"name":    *in,
+			"type":    "overlay",
+			"version": "1.0",
+			"format":  *format,
+			"minzoom": strconv.Itoa(*minZoom),
+			"maxzoom": strconv.Itoa(*maxZoom),
+			"bounds": fmt.Sprintf("%f,%f,%f,%f",
+				b.NorthWest.Lng, b.SouthEast.Lat, b.SouthEast.Lng, b.NorthWest.Lat),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		w = tiles.NewDirTileWriter(*out, *format)
+	}
+
+	n, err := tiles.GeneratePyramid(raster, w, opts)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d tiles to %s", n, *out)
+}
+
+// parseBounds parses "north,west,south,east"
+func parseBounds(s string) (tiles.LatLngBounds, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return tiles.LatLngBounds{}, fmt.Errorf("bounds must be north,west,south,east")
+	}
+	var v [4]float64
+	for i, p := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return tiles.LatLngBounds{}, fmt.Errorf("bounds: %v", err)
+		}
+		v[i] = n
+	}
+	return tiles.LatLngBounds{
+		NorthWest: tiles.LatLng{Lat: v[0], Lng: v[1]},
+		SouthEast: tiles.LatLng{Lat: v[2], Lng: v[3]},
+	}, nil
+}
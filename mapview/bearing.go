@@ -0,0 +1,116 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+// Bearing returns the compass direction at the top of the view in degrees
+// clockwise from north, 0 for a north-up map
+func (mv *MapView) Bearing() float64 {
+	return mv.bearing
+}
+
+// SetBearing rotates the map around the view center so that the compass
+// direction bearing is at the top, stopping any animation. A heading-up
+// display sets the heading as the bearing.
+func (mv *MapView) SetBearing(bearing float64) {
+	mv.stopMotion()
+	mv.setBearing(bearing)
+	mv.invalidate()
+}
+
+// RotateTo turns the map to bearing in duration, the shorter way round
+func (mv *MapView) RotateTo(bearing float64, duration time.Duration) {
+	if duration <= 0 {
+		duration = DefaultAnimationDuration
+	}
+	center, zoom := mv.center, mv.zoom
+	mv.startAnimation(duration, func(t float64) (tiles.LatLng, float64) {
+		return center, zoom
+	})
+	mv.anim.toBearing = normalizeBearing(bearing)
+}
+
+func (mv *MapView) setBearing(bearing float64) {
+	mv.bearing = normalizeBearing(bearing)
+	if mv.size != (image.Point{}) {
+		mv.updateVisibleTiles()
+	}
+}
+
+// normalizeBearing returns bearing between 0 and 360
+func normalizeBearing(bearing float64) float64 {
+	bearing = math.Mod(bearing, 360)
+	if bearing < 0 {
+		bearing += 360
+	}
+	return bearing
+}
+
+// lerpBearing interpolates between two bearings the shorter way round
+func lerpBearing(from, to, t float64) float64 {
+	d := math.Mod(to-from+540, 360) - 180
+	return normalizeBearing(from + d*t)
+}
+
+// rotate turns v clockwise on screen by deg degrees
+func rotate(v f32.Point, deg float64) f32.Point {
+	s, c := math.Sincos(deg * math.Pi / 180)
+	x, y := float64(v.X), float64(v.Y)
+	return f32.Pt(float32(x*c-y*s), float32(x*s+y*c))
+}
+
+// toMap turns a screen vector into the north-up frame of the world plane
+func (mv *MapView) toMap(v f32.Point) f32.Point {
+	if mv.bearing == 0 {
+		return v
+	}
+	return rotate(v, mv.bearing)
+}
+
+// toScreen turns a vector of the north-up world plane into screen space
+func (mv *MapView) toScreen(v f32.Point) f32.Point {
+	if mv.bearing == 0 {
+		return v
+	}
+	return rotate(v, -mv.bearing)
+}
+
+// tileArea returns the size of the north-up box around the rotated view,
+// the area tiles are needed for
+func (mv *MapView) tileArea() image.Point {
+	if mv.bearing == 0 {
+		return mv.size
+	}
+	s, c := math.Sincos(mv.bearing * math.Pi / 180)
+	s, c = math.Abs(s), math.Abs(c)
+	w, h := float64(mv.size.X), float64(mv.size.Y)
+	return image.Pt(int(math.Ceil(w*c+h*s)), int(math.Ceil(w*s+h*c)))
+}
+
+// rotating reports whether a mouse press starts a rotation instead of a
+// pan: a right button drag or a drag with Ctrl held
+func rotating(ev pointer.Event) bool {
+	return ev.Buttons.Contain(pointer.ButtonSecondary) || ev.Modifiers.Contain(key.ModCtrl)
+}
+
+// rotateDrag turns the map by the angle the pointer moved from prev to pos
+// around the view center
+func (mv *MapView) rotateDrag(prev, pos f32.Point) {
+	c := mv.screenCenter()
+	a, b := prev.Sub(c), pos.Sub(c)
+	// Close to the center the angle jumps around
+	if math.Hypot(float64(a.X), float64(a.Y)) < tapSlop || math.Hypot(float64(b.X), float64(b.Y)) < tapSlop {
+		return
+	}
+	d := math.Atan2(float64(b.Y), float64(b.X)) - math.Atan2(float64(a.Y), float64(a.X))
+	// The map turns with the pointer, clockwise on screen lowers the bearing
+	mv.setBearing(mv.bearing - normalizeAngle(d)*180/math.Pi)
+}
@@ -0,0 +1,83 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+func TestBearingScreenToLatLng(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	mv.SetView(tiles.LatLng{Lat: 10, Lng: 20}, 8)
+	east := mv.screenToLatLng(f32.Pt(500, 300))
+
+	// Heading east, what was right of the center is above it
+	mv.SetBearing(90)
+	got := mv.screenToLatLng(f32.Pt(400, 200))
+	if math.Abs(got.Lat-east.Lat) > 1e-9 || math.Abs(got.Lng-east.Lng) > 1e-9 {
+		t.Errorf("above the center is %v, want %v", got, east)
+	}
+
+	// Zooming around a point keeps it in place when rotated
+	mv.SetBearing(33)
+	pos := f32.Pt(650, 120)
+	ll := mv.screenToLatLng(pos)
+	mv.zoomAround(pos, ll, 9.5)
+	if got := mv.screenToLatLng(pos); math.Abs(got.Lat-ll.Lat) > 1e-9 || math.Abs(got.Lng-ll.Lng) > 1e-9 {
+		t.Errorf("anchor moved to %v, want %v", got, ll)
+	}
+}
+
+func TestBearingVisibleTiles(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 200)
+	mv.SetView(tiles.LatLng{Lat: 10, Lng: 20}, 8)
+	mv.SetBearing(45)
+
+	// Every corner of the rotated view needs a tile
+	visible := make(map[tiles.Tile]bool)
+	for _, tile := range mv.visibleTiles {
+		visible[tile] = true
+	}
+	for _, corner := range []f32.Point{{}, {X: 800}, {Y: 200}, {X: 800, Y: 200}} {
+		tile := tiles.LatLngToTile(mv.screenToLatLng(corner), mv.targetZoom)
+		if !visible[tile] {
+			t.Errorf("corner %v shows tile %v, not among the visible tiles", corner, tile)
+		}
+	}
+}
+
+func TestRotateToShortestWay(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	mv.SetBearing(350)
+	mv.RotateTo(20, time.Second)
+
+	a := mv.anim
+	if got := lerpBearing(a.fromBearing, a.toBearing, 0.5); math.Abs(got-5) > 1e-9 {
+		t.Errorf("halfway bearing %v, want 5 across north", got)
+	}
+}
+
+func TestTwistRotates(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	for _, ev := range []pointer.Event{
+		touchEvent(pointer.Press, 1, 300, 300, 0),
+		touchEvent(pointer.Press, 2, 500, 300, 0),
+		// A quarter turn clockwise around the centroid
+		touchEvent(pointer.Drag, 1, 400, 200, 20),
+		touchEvent(pointer.Drag, 2, 400, 400, 20),
+	} {
+		mv.touch(ev)
+	}
+	if math.Abs(mv.Bearing()-270) > 1e-6 {
+		t.Errorf("bearing %v after a clockwise quarter turn, want 270", mv.Bearing())
+	}
+}
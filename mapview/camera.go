@@ -0,0 +1,337 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+// DefaultAnimationDuration is the duration of PanTo and ZoomTo when given
+// zero
+const DefaultAnimationDuration = 500 * time.Millisecond
+
+// Center returns the geographical center of the view
+func (mv *MapView) Center() tiles.LatLng {
+	return mv.center
+}
+
+// Zoom returns the fractional zoom level of the view
+func (mv *MapView) Zoom() float64 {
+	return mv.zoom
+}
+
+// Bounds returns the area shown by the view, the box around it when the
+// map is rotated. It is zero before the first Layout. Longitudes are not
+// wrapped, so that west is always less than east: across the antimeridian
+// one of them lies beyond ±180°.
+func (mv *MapView) Bounds() tiles.LatLngBounds {
+	if mv.size == (image.Point{}) {
+		return tiles.LatLngBounds{}
+	}
+	return mv.boxBounds(f32.Point{}, f32.Pt(float32(mv.size.X), float32(mv.size.Y)))
+}
+
+// SetCenter moves the view to center, stopping any animation
+func (mv *MapView) SetCenter(center tiles.LatLng) {
+	mv.SetView(center, mv.zoom)
+}
+
+// SetZoom changes the zoom level around the view center, stopping any
+// animation
+func (mv *MapView) SetZoom(zoom float64) {
+	mv.SetView(mv.center, zoom)
+}
+
+// SetView moves the view to center at zoom, stopping any animation
+func (mv *MapView) SetView(center tiles.LatLng, zoom float64) {
+	mv.stopMotion()
+	mv.pendingFit = nil
+	mv.setView(center, zoom)
+	mv.invalidate()
+}
+
+// FitBounds sets the largest zoom level showing all of bounds with padding
+// pixels to spare on every side, centered in the view. Before the first
+// Layout the fit is applied once the view size is known.
+func (mv *MapView) FitBounds(bounds tiles.LatLngBounds, padding int) {
+	mv.stopMotion()
+	if mv.size == (image.Point{}) {
+		mv.pendingFit = &fit{bounds: bounds, padding: padding}
+		return
+	}
+	center, zoom := mv.fitView(bounds, padding)
+	mv.SetView(center, zoom)
+}
+
+// view is a camera position
+type view struct {
+	center  tiles.LatLng
+	zoom    float64
+	bearing float64
+}
+
+type fit struct {
+	bounds  tiles.LatLngBounds
+	padding int
+}
+
+// fitView returns the view showing bounds with padding
+func (mv *MapView) fitView(bounds tiles.LatLngBounds, padding int) (tiles.LatLng, float64) {
+	x0, y0 := tiles.CalculateWorldCoordinates(bounds.NorthWest, 0)
+	x1, y1 := tiles.CalculateWorldCoordinates(bounds.SouthEast, 0)
+	if x1 < x0 {
+		// The bounds cross the antimeridian, east is in the next world
+		x1 += tiles.TileSize
+	}
+	center := tiles.WorldToLatLng((x0+x1)/2, (y0+y1)/2, 0)
+	center.Lng = wrapLng(center.Lng)
+
+	w := math.Max(float64(mv.size.X-2*padding), 1)
+	h := math.Max(float64(mv.size.Y-2*padding), 1)
+	// Zoom 0 pixels of the bounds, at least a fraction of one for points
+	bw := math.Max(x1-x0, 1e-9)
+	bh := math.Max(math.Abs(y1-y0), 1e-9)
+	if mv.bearing != 0 {
+		// Fit the box around the rotated bounds
+		s, c := math.Sincos(mv.bearing * math.Pi / 180)
+		s, c = math.Abs(s), math.Abs(c)
+		bw, bh = bw*c+bh*s, bw*s+bh*c
+	}
+	zoom := math.Log2(math.Min(w/bw, h/bh))
+	return center, zoom
+}
+
+// PanTo moves the view center to center in duration, easing in and out
+func (mv *MapView) PanTo(center tiles.LatLng, duration time.Duration) {
+	mv.animateTo(center, mv.zoom, duration)
+}
+
+// ZoomTo changes the zoom level around the view center in duration
+func (mv *MapView) ZoomTo(zoom float64, duration time.Duration) {
+	mv.animateTo(mv.center, zoom, duration)
+}
+
+// FlyTo moves the view to center at zoom along the smooth and efficient
+// path of van Wijk and Nuij, zooming out for long distances so that the
+// way there stays in sight. A zero duration picks one from the length of
+// the path.
+func (mv *MapView) FlyTo(center tiles.LatLng, zoom float64, duration time.Duration) {
+	zoom = mv.clampZoom(zoom)
+	path := newFlightPath(mv.center, mv.zoom, center, zoom, float64(max(mv.size.X, 1)))
+	if duration <= 0 {
+		duration = time.Duration(path.length * float64(time.Second))
+		duration = max(300*time.Millisecond, min(duration, 3*time.Second))
+	}
+	mv.startAnimation(duration, path.at)
+}
+
+// Animating reports whether a camera animation, scroll zoom or coasting
+// pan is in progress
+func (mv *MapView) Animating() bool {
+	return mv.anim != nil || mv.scrollZoom.active || mv.kinetic.active
+}
+
+// StopAnimation stops a camera animation, scroll zoom or coasting pan
+// where it is
+func (mv *MapView) StopAnimation() {
+	mv.stopMotion()
+}
+
+// stopMotion stops everything that moves the camera on its own
+func (mv *MapView) stopMotion() {
+	mv.anim = nil
+	mv.scrollZoom.active = false
+	mv.kinetic.stop()
+}
+
+func (mv *MapView) animateTo(center tiles.LatLng, zoom float64, duration time.Duration) {
+	if duration <= 0 {
+		duration = DefaultAnimationDuration
+	}
+	zoom = mv.clampZoom(zoom)
+	x0, y0 := tiles.CalculateWorldCoordinates(mv.center, 0)
+	x1, y1 := tiles.CalculateWorldCoordinates(center, 0)
+	dx := shortestDX(x1 - x0)
+	z0 := mv.zoom
+	mv.startAnimation(duration, func(t float64) (tiles.LatLng, float64) {
+		t = easeInOut(t)
+		// Interpolate in the world plane so that the pan runs straight on
+		// screen
+		ll := tiles.WorldToLatLng(x0+dx*t, y0+(y1-y0)*t, 0)
+		ll.Lng = wrapLng(ll.Lng)
+		return ll, z0 + (zoom-z0)*t
+	})
+}
+
+// animateZoomAround zooms to zoom in duration, keeping the point at the
+// screen position pos in place
+func (mv *MapView) animateZoomAround(pos f32.Point, zoom float64, duration time.Duration) {
+	zoom = mv.clampZoom(zoom)
+	ll := mv.screenToLatLng(pos)
+	z0 := mv.zoom
+	mv.startAnimation(duration, func(t float64) (tiles.LatLng, float64) {
+		z := z0 + (zoom-z0)*easeInOut(t)
+		return mv.centerAround(pos, ll, z), z
+	})
+}
+
+// animation moves the camera along view over duration, from the first
+// frame it is handled in
+type animation struct {
+	start    time.Time
+	duration time.Duration
+	view     func(t float64) (tiles.LatLng, float64)
+	// The bearing turns from fromBearing to toBearing
+	fromBearing, toBearing float64
+}
+
+func (mv *MapView) startAnimation(duration time.Duration, view func(t float64) (tiles.LatLng, float64)) {
+	mv.stopMotion()
+	mv.pendingFit = nil
+	mv.anim = &animation{duration: duration, view: view, fromBearing: mv.bearing, toBearing: mv.bearing}
+	mv.invalidate()
+}
+
+// animate advances the camera animation to the frame time and asks for
+// the next frame
+func (mv *MapView) animate(gtx layout.Context) {
+	a := mv.anim
+	if a == nil {
+		return
+	}
+	if a.start.IsZero() {
+		a.start = gtx.Now
+	}
+	t := 1.0
+	if a.duration > 0 {
+		t = math.Min(float64(gtx.Now.Sub(a.start))/float64(a.duration), 1)
+	}
+	center, zoom := a.view(t)
+	if a.fromBearing != a.toBearing {
+		mv.bearing = lerpBearing(a.fromBearing, a.toBearing, easeInOut(t))
+	}
+	mv.setView(center, zoom)
+	if t < 1 {
+		gtx.Execute(op.InvalidateCmd{})
+	} else {
+		mv.anim = nil
+	}
+}
+
+// setView moves the view without touching animations
+func (mv *MapView) setView(center tiles.LatLng, zoom float64) {
+	center.Lat = math.Max(-85.0511, math.Min(center.Lat, 85.0511))
+	mv.center = center
+	mv.zoom = mv.clampZoom(zoom)
+	if mv.size != (image.Point{}) {
+		mv.updateVisibleTiles()
+	}
+}
+
+func (mv *MapView) clampZoom(zoom float64) float64 {
+	return math.Max(float64(mv.minZoom), math.Min(zoom, float64(mv.maxZoom)))
+}
+
+// invalidate asks the application for a frame
+func (mv *MapView) invalidate() {
+	select {
+	case mv.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// easeInOut is the cubic ease-in-out curve
+func easeInOut(t float64) float64 {
+	if t < 0.5 {
+		return 4 * t * t * t
+	}
+	u := 2*t - 2
+	return 1 + u*u*u/2
+}
+
+// flightPath is the van Wijk and Nuij zoom-and-pan path between two views.
+// Positions are zoom 0 world pixels and w is the width of the view in them.
+type flightPath struct {
+	x0, y0, dx, dy float64
+	w0, w1         float64
+	r0, length     float64
+	// still is set when the centers are the same and the path only zooms
+	still bool
+	width float64
+}
+
+// rho is the tradeoff between zooming and panning, the value van Wijk and
+// Nuij found most pleasant
+const rho = math.Sqrt2
+
+func newFlightPath(from tiles.LatLng, fromZoom float64, to tiles.LatLng, toZoom float64, width float64) flightPath {
+	x0, y0 := tiles.CalculateWorldCoordinates(from, 0)
+	x1, y1 := tiles.CalculateWorldCoordinates(to, 0)
+	p := flightPath{
+		x0: x0, y0: y0, dx: shortestDX(x1 - x0), dy: y1 - y0,
+		w0:    width / math.Pow(2, fromZoom),
+		w1:    width / math.Pow(2, toZoom),
+		width: width,
+	}
+	d := math.Hypot(p.dx, p.dy)
+	if d < 1e-9 {
+		p.still = true
+		p.length = math.Abs(math.Log(p.w1/p.w0)) / rho
+		return p
+	}
+	r := func(b float64) float64 { return math.Log(math.Sqrt(b*b+1) - b) }
+	rho2, rho4 := rho*rho, rho*rho*rho*rho
+	b0 := (p.w1*p.w1 - p.w0*p.w0 + rho4*d*d) / (2 * p.w0 * rho2 * d)
+	b1 := (p.w1*p.w1 - p.w0*p.w0 - rho4*d*d) / (2 * p.w1 * rho2 * d)
+	p.r0 = r(b0)
+	r1 := r(b1)
+	p.length = (r1 - p.r0) / rho
+	return p
+}
+
+// at returns the view at t of the way, between 0 and 1
+func (p flightPath) at(t float64) (tiles.LatLng, float64) {
+	var u, w float64
+	if p.still {
+		u = t
+		w = p.w0 * math.Pow(p.w1/p.w0, t)
+	} else {
+		s := t * p.length
+		d := math.Hypot(p.dx, p.dy)
+		u = p.w0 / (rho * rho * d) * (math.Cosh(p.r0)*math.Tanh(rho*s+p.r0) - math.Sinh(p.r0))
+		w = p.w0 * math.Cosh(p.r0) / math.Cosh(rho*s+p.r0)
+	}
+	if t >= 1 {
+		u, w = 1, p.w1
+	}
+	center := tiles.WorldToLatLng(p.x0+p.dx*u, p.y0+p.dy*u, 0)
+	center.Lng = wrapLng(center.Lng)
+	return center, math.Log2(p.width / w)
+}
+
+// shortestDX returns the zoom 0 world distance dx, or the one of the same
+// place in the neighbouring world, whichever is shorter, so that moves
+// cross the antimeridian instead of going the long way around
+func shortestDX(dx float64) float64 {
+	dx = math.Mod(dx, tiles.TileSize)
+	if dx > tiles.TileSize/2 {
+		dx -= tiles.TileSize
+	} else if dx <= -tiles.TileSize/2 {
+		dx += tiles.TileSize
+	}
+	return dx
+}
+
+// wrapLng returns lng between -180 and 180
+func wrapLng(lng float64) float64 {
+	lng = math.Mod(lng+180, 360)
+	if lng < 0 {
+		lng += 360
+	}
+	return lng - 180
+}
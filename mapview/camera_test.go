@@ -0,0 +1,104 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+func newTestView(t *testing.T) *MapView {
+	mv := NewWithOptions(make(chan struct{}, 1), Options{
+		TileManager: tiles.NewTileManager(tiles.NewLocalTileProvider()),
+	})
+	t.Cleanup(func() { mv.Close() })
+	return mv
+}
+
+func TestFlightPathEnds(t *testing.T) {
+	paris := tiles.LatLng{Lat: 48.8566, Lng: 2.3522}
+	tokyo := tiles.LatLng{Lat: 35.6762, Lng: 139.6503}
+	p := newFlightPath(paris, 12, tokyo, 10, 800)
+
+	center, zoom := p.at(0)
+	if math.Abs(center.Lat-paris.Lat) > 1e-6 || math.Abs(center.Lng-paris.Lng) > 1e-6 || math.Abs(zoom-12) > 1e-6 {
+		t.Errorf("path starts at %v zoom %v", center, zoom)
+	}
+	center, zoom = p.at(1)
+	if math.Abs(center.Lat-tokyo.Lat) > 1e-6 || math.Abs(center.Lng-tokyo.Lng) > 1e-6 || math.Abs(zoom-10) > 1e-6 {
+		t.Errorf("path ends at %v zoom %v", center, zoom)
+	}
+	// A long flight zooms out well below both ends on the way
+	if _, mid := p.at(0.5); mid > 6 {
+		t.Errorf("zoom %v halfway, want a zoomed out overview", mid)
+	}
+}
+
+func TestFitBounds(t *testing.T) {
+	mv := newTestView(t)
+	bounds := tiles.LatLngBounds{
+		NorthWest: tiles.LatLng{Lat: 52, Lng: -2},
+		SouthEast: tiles.LatLng{Lat: 51, Lng: 2},
+	}
+	// Before the first layout the fit waits for the view size
+	mv.FitBounds(bounds, 20)
+	if mv.pendingFit == nil {
+		t.Fatal("fit not deferred")
+	}
+
+	mv.size = image.Pt(800, 600)
+	mv.FitBounds(bounds, 20)
+	got := mv.Bounds()
+	if got.NorthWest.Lat < 52 || got.NorthWest.Lng > -2 || got.SouthEast.Lat > 51 || got.SouthEast.Lng < 2 {
+		t.Errorf("view %+v does not contain %+v", got, bounds)
+	}
+	// The wider side fills the view up to the padding
+	if span := got.SouthEast.Lng - got.NorthWest.Lng; span > 4*800/760.0+1e-6 {
+		t.Errorf("view spans %v degrees, want a tight fit", span)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	mv := newTestView(t)
+	if b := mv.Bounds(); b != (tiles.LatLngBounds{}) {
+		t.Errorf("bounds %+v before the first layout, want zero", b)
+	}
+	mv.size = image.Pt(800, 600)
+	mv.SetView(tiles.LatLng{Lat: 0, Lng: 180}, 6)
+	b := mv.Bounds()
+	if b.NorthWest.Lng >= 180 || b.SouthEast.Lng <= 180 || b.NorthWest.Lat <= b.SouthEast.Lat {
+		t.Errorf("bounds %+v, want them to span 180° from west to east", b)
+	}
+}
+
+func TestFitBoundsAcrossAntimeridian(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	// Fiji, from 177°E to 178°W
+	mv.FitBounds(tiles.LatLngBounds{
+		NorthWest: tiles.LatLng{Lat: -16, Lng: 177},
+		SouthEast: tiles.LatLng{Lat: -19, Lng: -178},
+	}, 20)
+	if d := math.Abs(wrapLng(mv.center.Lng - 179.5)); d > 1e-6 {
+		t.Errorf("center %v, want 179.5°E", mv.center)
+	}
+	// 5 degrees wide, not the whole world
+	if mv.zoom < 5 {
+		t.Errorf("zoom %v, want a tight fit", mv.zoom)
+	}
+}
+
+func TestFlightPathAcrossAntimeridian(t *testing.T) {
+	from := tiles.LatLng{Lat: 0, Lng: 170}
+	to := tiles.LatLng{Lat: 0, Lng: -170}
+	p := newFlightPath(from, 5, to, 5, 800)
+	// Halfway is at the antimeridian, not at the prime meridian
+	center, _ := p.at(0.5)
+	if d := math.Abs(wrapLng(center.Lng - 180)); d > 1e-6 {
+		t.Errorf("midway center %v, want 180°", center)
+	}
+	if center, _ := p.at(1); math.Abs(center.Lng-to.Lng) > 1e-6 {
+		t.Errorf("path ends at %v, want %v", center, to)
+	}
+}
@@ -0,0 +1,122 @@
+package mapview
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"gioui.org/f32"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+var (
+	boxFill   = color.NRGBA{R: 0x33, G: 0x66, B: 0xcc, A: 0x33}
+	boxStroke = color.NRGBA{R: 0x33, G: 0x66, B: 0xcc, A: 0xcc}
+)
+
+// clickZoom is the state of double-click and box zooming
+type clickZoom struct {
+	// lastClick is the time and position of a press that may be the first
+	// of a double-click
+	lastClick    pointer.Event
+	hasLastClick bool
+	// box is the rubber band of a Shift drag, nil when there is none
+	box *box
+}
+
+type box struct {
+	start, end f32.Point
+}
+
+// clickPress handles a mouse press for double-click and box zooming and
+// reports whether it used the press
+func (mv *MapView) clickPress(ev pointer.Event) bool {
+	if !ev.Buttons.Contain(pointer.ButtonPrimary) {
+		return false
+	}
+	c := &mv.clickZoom
+	if !mv.disableDoubleClick {
+		d := ev.Position.Sub(c.lastClick.Position)
+		if c.hasLastClick && ev.Time-c.lastClick.Time < doubleTapTimeout &&
+			math.Hypot(float64(d.X), float64(d.Y)) < doubleTapSlop {
+			c.hasLastClick = false
+			zoom := math.Round(mv.zoom) + 1
+			if ev.Modifiers.Contain(key.ModShift) || ev.Modifiers.Contain(key.ModAlt) {
+				zoom = math.Round(mv.zoom) - 1
+			}
+			mv.animateZoomAround(ev.Position, zoom, tapZoomDuration)
+			return true
+		}
+		c.lastClick = ev
+		c.hasLastClick = true
+	}
+	if !mv.disableBoxZoom && ev.Modifiers.Contain(key.ModShift) {
+		c.box = &box{start: ev.Position, end: ev.Position}
+		return true
+	}
+	return false
+}
+
+// clickDrag handles a mouse drag and reports whether it draws the box
+func (mv *MapView) clickDrag(ev pointer.Event) bool {
+	c := &mv.clickZoom
+	if d := ev.Position.Sub(c.lastClick.Position); math.Hypot(float64(d.X), float64(d.Y)) > tapSlop {
+		// A drag is no click
+		c.hasLastClick = false
+	}
+	if c.box == nil {
+		return false
+	}
+	c.box.end = ev.Position
+	return true
+}
+
+// clickRelease ends the box of a Shift drag, fitting the view to it
+func (mv *MapView) clickRelease(ev pointer.Event) {
+	c := &mv.clickZoom
+	b := c.box
+	c.box = nil
+	if b == nil || ev.Kind == pointer.Cancel {
+		return
+	}
+	d := b.end.Sub(b.start)
+	if math.Abs(float64(d.X)) < tapSlop || math.Abs(float64(d.Y)) < tapSlop {
+		// Too small to zoom to, most likely a Shift click
+		return
+	}
+	center, zoom := mv.fitView(mv.boxBounds(b.start, b.end), 0)
+	mv.animateTo(center, zoom, 0)
+}
+
+// boxBounds returns the geographical bounds of the screen rectangle with
+// corners a and b
+func (mv *MapView) boxBounds(a, b f32.Point) tiles.LatLngBounds {
+	bounds := tiles.LatLngBounds{
+		NorthWest: tiles.LatLng{Lat: -90, Lng: 180},
+		SouthEast: tiles.LatLng{Lat: 90, Lng: -180},
+	}
+	for _, corner := range []f32.Point{a, b, {X: a.X, Y: b.Y}, {X: b.X, Y: a.Y}} {
+		ll := mv.screenToLatLng(corner)
+		bounds.NorthWest.Lat = math.Max(bounds.NorthWest.Lat, ll.Lat)
+		bounds.NorthWest.Lng = math.Min(bounds.NorthWest.Lng, ll.Lng)
+		bounds.SouthEast.Lat = math.Min(bounds.SouthEast.Lat, ll.Lat)
+		bounds.SouthEast.Lng = math.Max(bounds.SouthEast.Lng, ll.Lng)
+	}
+	return bounds
+}
+
+// layoutBox draws the rubber band of a Shift drag
+func (mv *MapView) layoutBox(gtx layout.Context) {
+	b := mv.clickZoom.box
+	if b == nil {
+		return
+	}
+	r := image.Rectangle{Min: b.start.Round(), Max: b.end.Round()}.Canon()
+	paint.FillShape(gtx.Ops, boxFill, clip.Rect(r).Op())
+	paint.FillShape(gtx.Ops, boxStroke, clip.Stroke{Path: clip.Rect(r).Path(), Width: 1}.Op())
+}
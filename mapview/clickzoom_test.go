@@ -0,0 +1,102 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+func mouseEvent(kind pointer.Kind, x, y float32, ms int, mods key.Modifiers) pointer.Event {
+	return pointer.Event{
+		Kind:      kind,
+		Source:    pointer.Mouse,
+		Buttons:   pointer.ButtonPrimary,
+		Position:  f32.Pt(x, y),
+		Time:      time.Duration(ms) * time.Millisecond,
+		Modifiers: mods,
+	}
+}
+
+func TestDoubleClickZoom(t *testing.T) {
+	for _, tc := range []struct {
+		mods key.Modifiers
+		zoom float64
+	}{
+		{0, 9},
+		{key.ModShift, 7},
+		{key.ModAlt, 7},
+	} {
+		mv := newTestView(t)
+		mv.size = image.Pt(800, 600)
+		mv.SetView(tiles.LatLng{Lat: 10, Lng: 20}, 8)
+		// The zoom keeps the point under the second click in place
+		under := mv.screenToLatLng(f32.Pt(602, 151))
+
+		if mv.clickPress(mouseEvent(pointer.Press, 600, 150, 0, tc.mods)) && tc.mods == 0 {
+			t.Fatal("first click used")
+		}
+		mv.clickRelease(mouseEvent(pointer.Release, 600, 150, 50, tc.mods))
+		if !mv.clickPress(mouseEvent(pointer.Press, 602, 151, 200, tc.mods)) || mv.anim == nil {
+			t.Fatalf("modifiers %v: double-click does not zoom", tc.mods)
+		}
+		center, zoom := mv.anim.view(1)
+		if zoom != tc.zoom {
+			t.Errorf("modifiers %v: zoom to %v, want %v", tc.mods, zoom, tc.zoom)
+		}
+		mv.setView(center, zoom)
+		if got := mv.screenToLatLng(f32.Pt(602, 151)); math.Abs(got.Lat-under.Lat) > 1e-9 || math.Abs(got.Lng-under.Lng) > 1e-9 {
+			t.Errorf("modifiers %v: point under the cursor moved to %v, want %v", tc.mods, got, under)
+		}
+	}
+}
+
+func TestDoubleClickZoomDisabled(t *testing.T) {
+	mv := NewWithOptions(make(chan struct{}, 1), Options{
+		TileManager:            tiles.NewTileManager(tiles.NewLocalTileProvider()),
+		DisableDoubleClickZoom: true,
+	})
+	defer mv.Close()
+	mv.size = image.Pt(800, 600)
+	mv.clickPress(mouseEvent(pointer.Press, 100, 100, 0, 0))
+	if mv.clickPress(mouseEvent(pointer.Press, 100, 100, 100, 0)) || mv.anim != nil {
+		t.Error("double-click zooms while disabled")
+	}
+}
+
+func TestBoxZoom(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	mv.SetView(tiles.LatLng{Lat: 10, Lng: 20}, 8)
+	want := mv.boxBounds(f32.Pt(100, 100), f32.Pt(300, 250))
+
+	if !mv.clickPress(mouseEvent(pointer.Press, 100, 100, 0, key.ModShift)) {
+		t.Fatal("Shift press does not start a box")
+	}
+	mv.clickDrag(mouseEvent(pointer.Drag, 200, 180, 50, key.ModShift))
+	mv.clickDrag(mouseEvent(pointer.Drag, 300, 250, 100, key.ModShift))
+	if b := mv.clickZoom.box; b == nil || b.end != f32.Pt(300, 250) {
+		t.Fatalf("box %+v, want it to follow the drag", b)
+	}
+	mv.clickRelease(mouseEvent(pointer.Release, 300, 250, 150, key.ModShift))
+	if mv.clickZoom.box != nil || mv.anim == nil {
+		t.Fatal("release does not zoom to the box")
+	}
+
+	center, zoom := mv.anim.view(1)
+	mv.setView(center, zoom)
+	got := mv.Bounds()
+	if got.NorthWest.Lat < want.NorthWest.Lat-1e-9 || got.NorthWest.Lng > want.NorthWest.Lng+1e-9 ||
+		got.SouthEast.Lat > want.SouthEast.Lat+1e-9 || got.SouthEast.Lng < want.SouthEast.Lng-1e-9 {
+		t.Errorf("view %+v does not contain the box %+v", got, want)
+	}
+	// The box was 200 wide in an 800 wide view
+	if math.Abs(zoom-10) > 1e-6 {
+		t.Errorf("zoom %v, want 10", zoom)
+	}
+}
@@ -0,0 +1,437 @@
+package mapview
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"sync"
+
+	"gioui.org/f32"
+	"gioui.org/font"
+	"gioui.org/font/gofont"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"github.com/olablt/gio-tiles/tiles"
+	"github.com/olablt/gio-tiles/tiles/geojson"
+)
+
+// FeatureStyle is how a GeoJSON feature is drawn
+type FeatureStyle struct {
+	// Style draws lines and areas, and the dots of points without an Icon
+	Style
+	// Icon is drawn for points, with its Anchor placed on them as for a
+	// Marker
+	Icon   image.Image
+	Anchor f32.Point
+	// PointRadius is the radius of the dots, in pixels
+	PointRadius float32
+	// Label names the property whose value is written on the feature
+	Label      string
+	LabelColor color.NRGBA
+	LabelSize  unit.Sp
+	// Set lists the fields a rule applies even when they are zero, such as
+	// a transparent FillColor or a zero StrokeWidth to turn the fill or
+	// outline off
+	Set StyleFields
+}
+
+// StyleFields is a set of FeatureStyle fields
+type StyleFields uint16
+
+const (
+	SetStrokeColor StyleFields = 1 << iota
+	SetStrokeWidth
+	SetDash
+	SetFillColor
+	// SetOpacity with a zero Opacity hides the feature, where an Opacity
+	// left zero means 1
+	SetOpacity
+	// SetIcon sets the Icon and its Anchor
+	SetIcon
+	SetPointRadius
+	SetLabel
+	SetLabelColor
+	SetLabelSize
+)
+
+// DefaultFeatureStyle is the style rules and GeoJSONOptions.Default apply to
+var DefaultFeatureStyle = FeatureStyle{
+	Style: Style{
+		StrokeColor: color.NRGBA{R: 0x33, G: 0x88, B: 0xff, A: 0xff},
+		StrokeWidth: 2,
+		FillColor:   color.NRGBA{R: 0x33, G: 0x88, B: 0xff, A: 0x50},
+	},
+	PointRadius: 5,
+	LabelColor:  color.NRGBA{A: 0xff},
+	LabelSize:   12,
+}
+
+// Match selects features by their properties
+type Match interface {
+	match(props map[string]any) bool
+}
+
+// Equals matches features whose property equals value. Numbers of any Go
+// type compare by value.
+func Equals(property string, value any) Match {
+	return equalsMatch{property, value}
+}
+
+// InRange matches features whose property is a number from min up to, but
+// not including, max. Use math.Inf for open ranges.
+func InRange(property string, min, max float64) Match {
+	return rangeMatch{property, min, max}
+}
+
+// OneOf matches features whose property equals any of values, for
+// categories
+func OneOf(property string, values ...any) Match {
+	return oneOfMatch{property, values}
+}
+
+type equalsMatch struct {
+	property string
+	value    any
+}
+
+type rangeMatch struct {
+	property string
+	min, max float64
+}
+
+type oneOfMatch struct {
+	property string
+	values   []any
+}
+
+func (m equalsMatch) match(props map[string]any) bool {
+	v, ok := props[m.property]
+	return ok && propertyEqual(v, m.value)
+}
+
+func (m rangeMatch) match(props map[string]any) bool {
+	v, ok := number(props[m.property])
+	return ok && v >= m.min && v < m.max
+}
+
+func (m oneOfMatch) match(props map[string]any) bool {
+	v, ok := props[m.property]
+	if !ok {
+		return false
+	}
+	for _, value := range m.values {
+		if propertyEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// propertyEqual compares a property with a rule value. Only numbers,
+// strings, booleans and null can be equal.
+func propertyEqual(v, value any) bool {
+	if a, ok := number(v); ok {
+		b, ok := number(value)
+		return ok && a == b
+	}
+	switch v := v.(type) {
+	case string:
+		s, ok := value.(string)
+		return ok && s == v
+	case bool:
+		b, ok := value.(bool)
+		return ok && b == v
+	case nil:
+		return value == nil
+	}
+	return false
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// StyleRule sets the style of the features Match selects, all features when
+// it is nil. The fields of Style that are not zero or are in Style.Set
+// replace those of the default and of earlier rules, so that rules can be
+// combined: one may fill by a range of values while another labels every
+// feature.
+type StyleRule struct {
+	Match Match
+	Style FeatureStyle
+}
+
+// GeoJSONOptions configures a GeoJSONLayer
+type GeoJSONOptions struct {
+	// Default applies over DefaultFeatureStyle in the same way as rules
+	Default FeatureStyle
+	Rules   []StyleRule
+	// Shaper writes the labels, one with the Go fonts when nil
+	Shaper *text.Shaper
+}
+
+// GeoJSONLayer is a Layer that draws GeoJSON features, styled by rules on
+// their properties. Lines and areas are drawn as in a VectorLayer, points
+// and labels as markers above them. Its methods may be called from any
+// goroutine.
+type GeoJSONLayer struct {
+	mu      sync.Mutex
+	fc      *geojson.FeatureCollection
+	opts    GeoJSONOptions
+	vectors *VectorLayer
+	markers *MarkerLayer
+}
+
+func NewGeoJSONLayer(fc *geojson.FeatureCollection, opts GeoJSONOptions) *GeoJSONLayer {
+	l := &GeoJSONLayer{fc: fc, opts: opts}
+	l.build()
+	return l
+}
+
+// SetRules restyles the features with rules
+func (l *GeoJSONLayer) SetRules(rules []StyleRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.opts.Rules = rules
+	l.build()
+}
+
+// Style returns the style of f, as for a legend
+func (l *GeoJSONLayer) Style(f *geojson.Feature) FeatureStyle {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.style(f)
+}
+
+func (l *GeoJSONLayer) style(f *geojson.Feature) FeatureStyle {
+	s := DefaultFeatureStyle.merge(l.opts.Default)
+	for _, r := range l.opts.Rules {
+		if r.Match == nil || r.Match.match(f.Properties) {
+			s = s.merge(r.Style)
+		}
+	}
+	return s
+}
+
+// merge returns s with the fields of o that are not zero or are in o.Set
+func (s FeatureStyle) merge(o FeatureStyle) FeatureStyle {
+	set := func(f StyleFields, nonZero bool) bool {
+		return nonZero || o.Set&f != 0
+	}
+	if set(SetStrokeColor, o.StrokeColor != (color.NRGBA{})) {
+		s.StrokeColor = o.StrokeColor
+	}
+	if set(SetStrokeWidth, o.StrokeWidth != 0) {
+		s.StrokeWidth = o.StrokeWidth
+	}
+	if set(SetDash, o.Dash != nil) {
+		s.Dash = o.Dash
+	}
+	if set(SetFillColor, o.FillColor != (color.NRGBA{})) {
+		s.FillColor = o.FillColor
+	}
+	if set(SetOpacity, o.Opacity != 0) {
+		s.Opacity = o.Opacity
+		// Remember that a zero Opacity was set, see hidden
+		s.Set |= o.Set & SetOpacity
+	}
+	if set(SetIcon, o.Icon != nil) {
+		s.Icon = o.Icon
+		s.Anchor = o.Anchor
+	}
+	if set(SetPointRadius, o.PointRadius != 0) {
+		s.PointRadius = o.PointRadius
+	}
+	if set(SetLabel, o.Label != "") {
+		s.Label = o.Label
+	}
+	if set(SetLabelColor, o.LabelColor != (color.NRGBA{})) {
+		s.LabelColor = o.LabelColor
+	}
+	if set(SetLabelSize, o.LabelSize != 0) {
+		s.LabelSize = o.LabelSize
+	}
+	return s
+}
+
+// hidden reports whether a rule set the opacity of s to zero
+func (s FeatureStyle) hidden() bool {
+	return s.Set&SetOpacity != 0 && s.Opacity <= 0
+}
+
+// build converts the features to shapes and markers, with l.mu held or
+// before l is shared
+func (l *GeoJSONLayer) build() {
+	l.vectors = NewVectorLayer()
+	l.markers = NewMarkerLayer()
+	if l.fc == nil {
+		return
+	}
+	for i, f := range l.fc.Features {
+		if f.Geometry == nil {
+			continue
+		}
+		s := l.style(f)
+		if s.hidden() {
+			continue
+		}
+		b := featureBuilder{l: l, id: strconv.Itoa(i), style: s}
+		b.add(f.Geometry)
+		if s.Label == "" {
+			continue
+		}
+		v, ok := f.Properties[s.Label]
+		if !ok || v == nil {
+			continue
+		}
+		pos, anchor, ok := labelPosition(f.Geometry)
+		if !ok {
+			continue
+		}
+		l.markers.Add(b.id+"/label", Marker{
+			Position: pos,
+			Anchor:   anchor,
+			ZIndex:   1,
+			Widget:   l.label(propertyText(v), s),
+		})
+	}
+}
+
+// featureBuilder adds the parts of a feature's geometry
+type featureBuilder struct {
+	l     *GeoJSONLayer
+	id    string
+	style FeatureStyle
+	n     int
+}
+
+func (b *featureBuilder) next() string {
+	b.n++
+	return fmt.Sprintf("%s/%d", b.id, b.n)
+}
+
+func (b *featureBuilder) add(g *geojson.Geometry) {
+	for _, rings := range g.Polygons {
+		open := make([][]tiles.LatLng, len(rings))
+		for i, ring := range rings {
+			// Polygon rings close implicitly
+			open[i] = ring[:len(ring)-1]
+		}
+		b.l.vectors.Add(b.next(), Polygon{Rings: open, Style: b.style.Style})
+	}
+	for _, line := range g.Lines {
+		b.l.vectors.Add(b.next(), Polyline{Points: line, Style: b.style.Style})
+	}
+	for _, p := range g.Points {
+		m := Marker{Position: p, Icon: b.style.Icon, Anchor: b.style.Anchor}
+		if m.Icon == nil {
+			m.Widget = dot(b.style.PointRadius, b.style.Style)
+			m.Anchor = f32.Pt(0.5, 0.5)
+		}
+		b.l.markers.Add(b.next(), m)
+	}
+	for _, child := range g.Geometries {
+		b.add(child)
+	}
+}
+
+// labelPosition returns where the label of a geometry goes: below a single
+// point, or centered on the bounds of anything else
+func labelPosition(g *geojson.Geometry) (tiles.LatLng, f32.Point, bool) {
+	if g.Type == geojson.Point {
+		return g.Points[0], f32.Pt(0.5, 0), true
+	}
+	bounds, ok := g.Bounds()
+	center := tiles.LatLng{
+		Lat: (bounds.NorthWest.Lat + bounds.SouthEast.Lat) / 2,
+		Lng: (bounds.NorthWest.Lng + bounds.SouthEast.Lng) / 2,
+	}
+	return center, f32.Pt(0.5, 0.5), ok
+}
+
+// propertyText formats a property value for a label
+func propertyText(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// label returns a widget that writes txt in the label style of s
+func (l *GeoJSONLayer) label(txt string, s FeatureStyle) layout.Widget {
+	if l.opts.Shaper == nil {
+		l.opts.Shaper = text.NewShaper(text.WithCollection(gofont.Collection()))
+	}
+	shaper := l.opts.Shaper
+	c := fade(s.LabelColor, opacity(s.Opacity))
+	return func(gtx layout.Context) layout.Dimensions {
+		m := op.Record(gtx.Ops)
+		paint.ColorOp{Color: c}.Add(gtx.Ops)
+		material := m.Stop()
+		return widget.Label{MaxLines: 1}.Layout(gtx, shaper, font.Font{}, s.LabelSize, txt, material)
+	}
+}
+
+// dot returns a widget that draws a circle of radius, in pixels, with the
+// fill and stroke of s
+func dot(radius float32, s Style) layout.Widget {
+	o := opacity(s.Opacity)
+	return func(gtx layout.Context) layout.Dimensions {
+		w := s.StrokeWidth
+		if s.StrokeColor.A == 0 {
+			w = 0
+		}
+		size := int(math.Ceil(float64(2*radius + w)))
+		inset := int(math.Round(float64(w / 2)))
+		e := clip.Ellipse{Min: image.Pt(inset, inset), Max: image.Pt(size-inset, size-inset)}
+		if s.FillColor.A > 0 {
+			paint.FillShape(gtx.Ops, fade(s.FillColor, o), e.Op(gtx.Ops))
+		}
+		if w > 0 {
+			paint.FillShape(gtx.Ops, fade(s.StrokeColor, o), clip.Stroke{Path: e.Path(gtx.Ops), Width: w}.Op())
+		}
+		return layout.Dimensions{Size: image.Pt(size, size)}
+	}
+}
+
+// opacity returns the effective opacity of a Style.Opacity
+func opacity(o float32) float32 {
+	if o <= 0 {
+		return 1
+	}
+	return o
+}
+
+// Layout draws the features that are in view
+func (l *GeoJSONLayer) Layout(gtx layout.Context, proj Projection) {
+	l.mu.Lock()
+	vectors, markers := l.vectors, l.markers
+	l.mu.Unlock()
+	vectors.Layout(gtx, proj)
+	markers.Layout(gtx, proj)
+}
@@ -0,0 +1,138 @@
+package mapview
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"github.com/olablt/gio-tiles/tiles"
+	"github.com/olablt/gio-tiles/tiles/geojson"
+)
+
+func TestMatch(t *testing.T) {
+	props := map[string]any{"pop": 1500.0, "kind": "lake", "wet": true, "none": nil}
+	for _, tc := range []struct {
+		name  string
+		m     Match
+		match bool
+	}{
+		{"equal number of another type", Equals("pop", 1500), true},
+		{"equal string", Equals("kind", "lake"), true},
+		{"string is not number", Equals("kind", 1500), false},
+		{"equal bool", Equals("wet", true), true},
+		{"equal null", Equals("none", nil), true},
+		{"missing property", Equals("area", nil), false},
+		{"in range", InRange("pop", 1000, 2000), true},
+		{"max excluded", InRange("pop", 1000, 1500), false},
+		{"open range", InRange("pop", math.Inf(-1), 1501), true},
+		{"range of string", InRange("kind", 0, 1), false},
+		{"category", OneOf("kind", "river", "lake"), true},
+		{"other category", OneOf("kind", "river", "sea"), false},
+	} {
+		if got := tc.m.match(props); got != tc.match {
+			t.Errorf("%s: match %v, want %v", tc.name, got, tc.match)
+		}
+	}
+}
+
+func TestGeoJSONStyleRules(t *testing.T) {
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	green := color.NRGBA{G: 0xff, A: 0xff}
+	l := NewGeoJSONLayer(nil, GeoJSONOptions{
+		Default: FeatureStyle{Style: Style{StrokeWidth: 1}},
+		Rules: []StyleRule{
+			{Match: InRange("pop", 0, 1000), Style: FeatureStyle{Style: Style{FillColor: red}}},
+			{Match: InRange("pop", 1000, math.Inf(1)), Style: FeatureStyle{Style: Style{FillColor: green}}},
+			{Style: FeatureStyle{Label: "name"}},
+		},
+	})
+	s := l.Style(&geojson.Feature{Properties: map[string]any{"pop": 5000.0}})
+	if s.FillColor != green || s.Label != "name" || s.StrokeWidth != 1 || s.StrokeColor != DefaultFeatureStyle.StrokeColor {
+		t.Errorf("style %+v", s)
+	}
+	s = l.Style(&geojson.Feature{Properties: map[string]any{"pop": 10.0}})
+	if s.FillColor != red {
+		t.Errorf("fill %v, want red", s.FillColor)
+	}
+	// Features without the property keep the default fill
+	s = l.Style(&geojson.Feature{Properties: map[string]any{}})
+	if s.FillColor != DefaultFeatureStyle.FillColor {
+		t.Errorf("fill %v, want the default", s.FillColor)
+	}
+	// Rules can turn the fill and outline off
+	l.SetRules([]StyleRule{{
+		Match: Equals("kind", "water"),
+		Style: FeatureStyle{Set: SetFillColor | SetStrokeWidth},
+	}})
+	s = l.Style(&geojson.Feature{Properties: map[string]any{"kind": "water"}})
+	if s.FillColor != (color.NRGBA{}) || s.StrokeWidth != 0 || s.StrokeColor != DefaultFeatureStyle.StrokeColor {
+		t.Errorf("style %+v, want no fill and no outline", s.Style)
+	}
+}
+
+func TestGeoJSONLayer(t *testing.T) {
+	fc, err := geojson.Parse([]byte(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"name": "Vilnius", "pop": 588412},
+		 "geometry": {"type": "Point", "coordinates": [25.28, 54.69]}},
+		{"type": "Feature", "properties": {"name": "lake"},
+		 "geometry": {"type": "Polygon", "coordinates": [
+		   [[25, 54], [26, 54], [26, 55], [25, 55], [25, 54]],
+		   [[25.2, 54.2], [25.2, 54.8], [25.8, 54.8], [25.8, 54.2], [25.2, 54.2]]]}},
+		{"type": "Feature", "properties": {},
+		 "geometry": {"type": "GeometryCollection", "geometries": [
+		   {"type": "MultiLineString", "coordinates": [[[25, 54], [26, 55]], [[25, 55], [26, 54]]]},
+		   {"type": "MultiPoint", "coordinates": [[25, 54], [26, 55]]}]}},
+		{"type": "Feature", "properties": {"name": "nowhere"}, "geometry": null}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewGeoJSONLayer(fc, GeoJSONOptions{Rules: []StyleRule{{Style: FeatureStyle{Label: "pop"}}}})
+	// A polygon and two lines; three points and one label
+	if l.vectors.Len() != 3 || l.markers.Len() != 4 {
+		t.Fatalf("%d shapes and %d markers, want 3 and 4", l.vectors.Len(), l.markers.Len())
+	}
+	if s, _ := l.vectors.Shape("1/1"); len(s.(Polygon).Rings) != 2 || len(s.(Polygon).Rings[0]) != 4 {
+		t.Errorf("polygon %+v, want two open rings", s)
+	}
+	if m, ok := l.markers.Marker("0/label"); !ok || m.Position != (tiles.LatLng{Lat: 54.69, Lng: 25.28}) {
+		t.Errorf("label %+v", m)
+	}
+	if got := propertyText(588412.0); got != "588412" {
+		t.Errorf("label text %q", got)
+	}
+
+	// A zero opacity that is set hides the feature, one left zero does not
+	l.SetRules([]StyleRule{
+		{Match: Equals("name", "lake"), Style: FeatureStyle{Set: SetOpacity}},
+		{Match: Equals("name", "Vilnius"), Style: FeatureStyle{Style: Style{Opacity: 0}}},
+	})
+	if l.vectors.Len() != 2 || l.markers.Len() != 3 {
+		t.Errorf("%d shapes and %d markers with the lake hidden, want 2 and 3", l.vectors.Len(), l.markers.Len())
+	}
+	if s := l.Style(fc.Features[1]); !s.hidden() {
+		t.Errorf("lake style %+v is not hidden", s)
+	}
+	// A later rule can show it again
+	l.SetRules([]StyleRule{
+		{Style: FeatureStyle{Set: SetOpacity}},
+		{Match: Equals("name", "lake"), Style: FeatureStyle{Style: Style{Opacity: 0.5}}},
+	})
+	if l.vectors.Len() != 1 || l.markers.Len() != 0 {
+		t.Errorf("%d shapes and %d markers with only the lake shown, want 1 and 0", l.vectors.Len(), l.markers.Len())
+	}
+
+	l.SetRules([]StyleRule{{Match: Equals("name", "lake"), Style: FeatureStyle{Label: "name"}}})
+	if l.markers.Len() != 4 {
+		t.Errorf("%d markers after restyling, want 4", l.markers.Len())
+	}
+	if _, ok := l.markers.Marker("1/label"); !ok {
+		t.Error("lake is not labelled")
+	}
+
+	proj := Projection{Center: tiles.LatLng{Lat: 54.5, Lng: 25.5}, Zoom: 8, Size: image.Pt(800, 600)}
+	l.Layout(layout.Context{Ops: new(op.Ops)}, proj)
+}
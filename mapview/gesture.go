@@ -0,0 +1,239 @@
+package mapview
+
+import (
+	"math"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+)
+
+const (
+	// tapSlop is how far a pointer may move and still tap, in pixels
+	tapSlop = 10
+	// tapTimeout is the longest press that counts as a tap
+	tapTimeout = 300 * time.Millisecond
+	// doubleTapTimeout is the longest pause between the taps of a double
+	// tap, and doubleTapSlop the farthest they may be apart in pixels
+	doubleTapTimeout = 300 * time.Millisecond
+	doubleTapSlop    = 40
+	// tapZoomDuration is the duration of the zoom after a tap gesture
+	tapZoomDuration = 250 * time.Millisecond
+)
+
+type gestureKind int
+
+const (
+	// gestureTransform moves, scales and rotates the map with the pointers
+	gestureTransform gestureKind = iota
+	// gestureDoubleTap zooms in at pos
+	gestureDoubleTap
+	// gestureTwoFingerTap zooms out at pos
+	gestureTwoFingerTap
+)
+
+// gesture is a step of a touch gesture
+type gesture struct {
+	kind gestureKind
+	// pointers is the number of pointers down during a transform
+	pointers int
+	// A transform moves the point under from to to, scaling the map by
+	// scale and rotating it clockwise by rotation radians around to
+	from, to f32.Point
+	scale    float64
+	rotation float64
+	// pos is where a tap happened
+	pos  f32.Point
+	time time.Duration
+}
+
+type touchPointer struct {
+	id    pointer.ID
+	pos   f32.Point
+	start f32.Point
+	down  time.Duration
+}
+
+// gestureRecognizer turns touch pointer events into gestures. One pointer
+// pans, two pan, pinch and twist the map. Further pointers are tracked but
+// do not move the map.
+type gestureRecognizer struct {
+	// pointers are the pointers down, in the order they were pressed
+	pointers []touchPointer
+	// moved is set once a pointer of the gesture left its tap slop, and
+	// multi once a second pointer touched, at multiStart
+	moved      bool
+	multi      bool
+	multiStart time.Duration
+	// lastTap is the time and position of a single tap that may be the
+	// first of a double tap
+	lastTap    time.Duration
+	lastTapPos f32.Point
+	hasLastTap bool
+}
+
+// Add handles a touch event and returns the gestures it completes
+func (r *gestureRecognizer) Add(ev pointer.Event) []gesture {
+	switch ev.Kind {
+	case pointer.Press:
+		if len(r.pointers) == 0 {
+			r.moved = false
+			r.multi = false
+		}
+		r.pointers = append(r.pointers, touchPointer{id: ev.PointerID, pos: ev.Position, start: ev.Position, down: ev.Time})
+		if len(r.pointers) == 2 {
+			r.multi = true
+			r.multiStart = ev.Time
+		}
+	case pointer.Drag, pointer.Move:
+		i := r.index(ev.PointerID)
+		if i < 0 {
+			return nil
+		}
+		from, dist0, angle0 := r.frame()
+		p := &r.pointers[i]
+		p.pos = ev.Position
+		if d := p.pos.Sub(p.start); math.Hypot(float64(d.X), float64(d.Y)) > tapSlop {
+			r.moved = true
+		}
+		to, dist1, angle1 := r.frame()
+		g := gesture{kind: gestureTransform, pointers: len(r.pointers), from: from, to: to, scale: 1, time: ev.Time}
+		if len(r.pointers) >= 2 && dist0 > 0 {
+			g.scale = dist1 / dist0
+			g.rotation = normalizeAngle(angle1 - angle0)
+		}
+		if g.from == g.to && g.scale == 1 && g.rotation == 0 {
+			return nil
+		}
+		return []gesture{g}
+	case pointer.Release:
+		i := r.index(ev.PointerID)
+		if i < 0 {
+			return nil
+		}
+		pos, _, _ := r.frame()
+		p := r.pointers[i]
+		r.pointers = append(r.pointers[:i], r.pointers[i+1:]...)
+		if r.multi {
+			// Lifting the first of two still fingers taps, the rest of the
+			// gesture cannot
+			tap := !r.moved && len(r.pointers) == 1 && ev.Time-r.multiStart < tapTimeout
+			r.moved = true
+			r.hasLastTap = false
+			if tap {
+				return []gesture{{kind: gestureTwoFingerTap, pos: pos, time: ev.Time}}
+			}
+			return nil
+		}
+		if r.moved || len(r.pointers) > 0 || ev.Time-p.down >= tapTimeout {
+			r.hasLastTap = false
+			return nil
+		}
+		d := p.pos.Sub(r.lastTapPos)
+		if r.hasLastTap && ev.Time-r.lastTap < doubleTapTimeout && math.Hypot(float64(d.X), float64(d.Y)) < doubleTapSlop {
+			r.hasLastTap = false
+			return []gesture{{kind: gestureDoubleTap, pos: p.pos, time: ev.Time}}
+		}
+		r.lastTap = ev.Time
+		r.lastTapPos = p.pos
+		r.hasLastTap = true
+	case pointer.Cancel:
+		r.pointers = r.pointers[:0]
+		r.hasLastTap = false
+	}
+	return nil
+}
+
+// down returns the number of pointers down
+func (r *gestureRecognizer) down() int {
+	return len(r.pointers)
+}
+
+func (r *gestureRecognizer) index(id pointer.ID) int {
+	for i, p := range r.pointers {
+		if p.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// frame returns the centroid of the first two pointers with their distance
+// and angle, or the position of a single pointer
+func (r *gestureRecognizer) frame() (f32.Point, float64, float64) {
+	switch len(r.pointers) {
+	case 0:
+		return f32.Point{}, 0, 0
+	case 1:
+		return r.pointers[0].pos, 0, 0
+	}
+	a, b := r.pointers[0].pos, r.pointers[1].pos
+	d := b.Sub(a)
+	return a.Add(b).Mul(0.5), math.Hypot(float64(d.X), float64(d.Y)), math.Atan2(float64(d.Y), float64(d.X))
+}
+
+// normalizeAngle returns a between -π and π
+func normalizeAngle(a float64) float64 {
+	a = math.Mod(a, 2*math.Pi)
+	switch {
+	case a > math.Pi:
+		a -= 2 * math.Pi
+	case a < -math.Pi:
+		a += 2 * math.Pi
+	}
+	return a
+}
+
+// touch handles an event of a touch pointer
+func (mv *MapView) touch(ev pointer.Event) {
+	if ev.Kind == pointer.Press {
+		// A finger on the screen stops the map
+		mv.stopMotion()
+		if mv.gestures.down() == 0 {
+			mv.kinetic.start(ev.Position, ev.Time)
+			mv.touchPointers = 1
+		}
+	}
+	for _, g := range mv.gestures.Add(ev) {
+		switch g.kind {
+		case gestureTransform:
+			if g.pointers == 1 {
+				// Only one finger pans carry on after release, the samples
+				// start over when the other fingers lift
+				if mv.touchPointers != 1 {
+					mv.kinetic.start(g.from, g.time)
+				}
+				mv.kinetic.track(g.to, g.time)
+			}
+			mv.touchPointers = g.pointers
+			mv.transform(g)
+		case gestureDoubleTap:
+			mv.animateZoomAround(g.pos, math.Round(mv.zoom)+1, tapZoomDuration)
+		case gestureTwoFingerTap:
+			mv.animateZoomAround(g.pos, math.Round(mv.zoom)-1, tapZoomDuration)
+		}
+	}
+	if ev.Kind == pointer.Release && mv.gestures.down() == 0 {
+		mv.kinetic.release(ev.Time)
+	}
+}
+
+// transform applies a transform gesture
+func (mv *MapView) transform(g gesture) {
+	ll := mv.screenToLatLng(g.from)
+	if g.rotation != 0 {
+		// The map turns with the fingers, clockwise lowers the bearing
+		mv.bearing = normalizeBearing(mv.bearing - g.rotation*180/math.Pi)
+	}
+	zoom := mv.zoom
+	if g.scale != 1 {
+		zoom += math.Log2(g.scale)
+		mv.zoomDirection = 1
+		if g.scale < 1 {
+			mv.zoomDirection = -1
+		}
+		mv.zoomAnchor = ll
+		mv.lastZoom = mv.now
+	}
+	mv.zoomAround(g.to, ll, zoom)
+}
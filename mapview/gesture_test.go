@@ -0,0 +1,138 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+)
+
+func touchEvent(kind pointer.Kind, id pointer.ID, x, y float32, ms int) pointer.Event {
+	return pointer.Event{
+		Kind:      kind,
+		Source:    pointer.Touch,
+		PointerID: id,
+		Position:  f32.Pt(x, y),
+		Time:      time.Duration(ms) * time.Millisecond,
+	}
+}
+
+// feed passes events to r and returns the gestures
+func feed(r *gestureRecognizer, events ...pointer.Event) []gesture {
+	var gestures []gesture
+	for _, ev := range events {
+		gestures = append(gestures, r.Add(ev)...)
+	}
+	return gestures
+}
+
+func TestGesturePinch(t *testing.T) {
+	var r gestureRecognizer
+	gs := feed(&r,
+		touchEvent(pointer.Press, 1, 100, 100, 0),
+		touchEvent(pointer.Press, 2, 200, 100, 10),
+		// The second finger moves out to twice the distance
+		touchEvent(pointer.Drag, 2, 300, 100, 20),
+	)
+	if len(gs) != 1 {
+		t.Fatalf("got %d gestures, want 1", len(gs))
+	}
+	g := gs[0]
+	if g.kind != gestureTransform || g.pointers != 2 {
+		t.Fatalf("got %+v, want a two pointer transform", g)
+	}
+	if g.from != f32.Pt(150, 100) || g.to != f32.Pt(200, 100) {
+		t.Errorf("centroid moved from %v to %v, want (150,100) to (200,100)", g.from, g.to)
+	}
+	if math.Abs(g.scale-2) > 1e-9 || g.rotation != 0 {
+		t.Errorf("scale %v rotation %v, want 2 and 0", g.scale, g.rotation)
+	}
+}
+
+func TestGestureRotate(t *testing.T) {
+	var r gestureRecognizer
+	gs := feed(&r,
+		touchEvent(pointer.Press, 1, 100, 100, 0),
+		touchEvent(pointer.Press, 2, 200, 100, 0),
+		// A quarter turn clockwise on screen around the first finger
+		touchEvent(pointer.Drag, 2, 100, 200, 20),
+	)
+	if len(gs) != 1 || math.Abs(gs[0].rotation-math.Pi/2) > 1e-6 || math.Abs(gs[0].scale-1) > 1e-6 {
+		t.Fatalf("got %+v, want a quarter turn", gs)
+	}
+}
+
+func TestGestureTaps(t *testing.T) {
+	var r gestureRecognizer
+	gs := feed(&r,
+		touchEvent(pointer.Press, 1, 100, 100, 0),
+		touchEvent(pointer.Release, 1, 100, 100, 50),
+		touchEvent(pointer.Press, 1, 105, 102, 200),
+		touchEvent(pointer.Release, 1, 105, 102, 250),
+	)
+	if len(gs) != 1 || gs[0].kind != gestureDoubleTap || gs[0].pos != f32.Pt(105, 102) {
+		t.Fatalf("got %+v, want a double tap", gs)
+	}
+
+	// Taps too far apart in time are two single taps
+	gs = feed(&r,
+		touchEvent(pointer.Press, 1, 100, 100, 1000),
+		touchEvent(pointer.Release, 1, 100, 100, 1050),
+		touchEvent(pointer.Press, 1, 100, 100, 1500),
+		touchEvent(pointer.Release, 1, 100, 100, 1550),
+	)
+	if len(gs) != 0 {
+		t.Errorf("got %+v for slow taps, want none", gs)
+	}
+
+	gs = feed(&r,
+		touchEvent(pointer.Press, 1, 100, 100, 3000),
+		touchEvent(pointer.Press, 2, 200, 100, 3010),
+		touchEvent(pointer.Release, 1, 100, 100, 3100),
+		touchEvent(pointer.Release, 2, 200, 100, 3110),
+	)
+	if len(gs) != 1 || gs[0].kind != gestureTwoFingerTap || gs[0].pos != f32.Pt(150, 100) {
+		t.Fatalf("got %+v, want a two finger tap", gs)
+	}
+
+	// A pinch is no tap
+	gs = feed(&r,
+		touchEvent(pointer.Press, 1, 100, 100, 5000),
+		touchEvent(pointer.Press, 2, 200, 100, 5010),
+		touchEvent(pointer.Drag, 2, 250, 100, 5050),
+		touchEvent(pointer.Release, 1, 100, 100, 5100),
+		touchEvent(pointer.Release, 2, 250, 100, 5110),
+	)
+	for _, g := range gs {
+		if g.kind != gestureTransform {
+			t.Errorf("got %+v after a pinch, want only transforms", g)
+		}
+	}
+}
+
+func TestPinchKeepsPointUnderFingers(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	mv.SetView(mv.center, 10)
+
+	under := mv.screenToLatLng(f32.Pt(300, 200))
+	for _, ev := range []pointer.Event{
+		touchEvent(pointer.Press, 1, 250, 200, 0),
+		touchEvent(pointer.Press, 2, 350, 200, 0),
+		touchEvent(pointer.Drag, 1, 150, 200, 20),
+		touchEvent(pointer.Drag, 2, 450, 200, 20),
+	} {
+		mv.touch(ev)
+	}
+	// The fingers spread to 300px apart around the same centroid
+	if math.Abs(mv.zoom-(10+math.Log2(3))) > 1e-6 {
+		t.Errorf("zoom %v, want %v", mv.zoom, 10+math.Log2(3))
+	}
+	got := mv.screenToLatLng(f32.Pt(300, 200))
+	if math.Abs(got.Lat-under.Lat) > 1e-6 || math.Abs(got.Lng-under.Lng) > 1e-6 {
+		t.Errorf("point between the fingers moved to %v, want %v", got, under)
+	}
+}
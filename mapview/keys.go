@@ -0,0 +1,245 @@
+package mapview
+
+import (
+	"math"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+)
+
+// KeyAction is what a key binding does to the map
+type KeyAction int
+
+const (
+	// KeyPanUp and the other pan actions move the view while the key is
+	// held, faster the longer it is
+	KeyPanUp KeyAction = iota
+	KeyPanDown
+	KeyPanLeft
+	KeyPanRight
+	// KeyPageUp and the other page actions move the view by most of its
+	// size
+	KeyPageUp
+	KeyPageDown
+	KeyPageLeft
+	KeyPageRight
+	// KeyZoomIn and KeyZoomOut zoom by one level around the view center
+	KeyZoomIn
+	KeyZoomOut
+	// KeyRotateLeft and KeyRotateRight turn the map while the key is held
+	KeyRotateLeft
+	KeyRotateRight
+	// KeyReset flies back to the initial view, north-up
+	KeyReset
+)
+
+// KeyBinding binds the keys matched by Filter to Action. The Focus of the
+// filter is set by MapView.
+type KeyBinding struct {
+	Filter key.Filter
+	Action KeyAction
+}
+
+// DefaultKeyBindings are the bindings of a MapView without Options.Keys
+var DefaultKeyBindings = []KeyBinding{
+	{key.Filter{Name: key.NameUpArrow}, KeyPanUp},
+	{key.Filter{Name: key.NameDownArrow}, KeyPanDown},
+	{key.Filter{Name: key.NameLeftArrow}, KeyPanLeft},
+	{key.Filter{Name: key.NameRightArrow}, KeyPanRight},
+	{key.Filter{Name: key.NamePageUp}, KeyPageUp},
+	{key.Filter{Name: key.NamePageDown}, KeyPageDown},
+	{key.Filter{Name: "+", Optional: key.ModShift}, KeyZoomIn},
+	{key.Filter{Name: "=", Optional: key.ModShift}, KeyZoomIn},
+	{key.Filter{Name: "-"}, KeyZoomOut},
+	{key.Filter{Name: key.NameLeftArrow, Required: key.ModShift}, KeyRotateLeft},
+	{key.Filter{Name: key.NameRightArrow, Required: key.ModShift}, KeyRotateRight},
+	{key.Filter{Name: key.NameHome}, KeyReset},
+}
+
+const (
+	// keyPanSpeed is the pan speed when a key is pressed, in pixels per
+	// second. It grows to keyPanMaxSpeed after keyAccelTime.
+	keyPanSpeed    = 300
+	keyPanMaxSpeed = 1500
+	keyAccelTime   = time.Second
+	// keyPanStep moves the view at once on a key press, so that a short
+	// tap moves it too
+	keyPanStep = 40
+	// keyRotateSpeed is how fast a held key turns the map, in degrees per
+	// second, and keyRotateStep the turn on a press
+	keyRotateSpeed = 90
+	keyRotateStep  = 5
+	// keyPage is the part of the view size a page action moves
+	keyPage = 0.8
+	// keyZoomDuration is the duration of a zoom by key
+	keyZoomDuration = 250 * time.Millisecond
+)
+
+// keyboard is the keyboard state of a MapView
+type keyboard struct {
+	bindings []KeyBinding
+	focused  bool
+	// held maps the held continuous actions to when they were pressed
+	held map[KeyAction]time.Time
+	// heldKeys maps each held key to its action, releases are matched by
+	// name as the modifiers may have changed since the press
+	heldKeys  map[key.Name]KeyAction
+	lastFrame time.Time
+}
+
+// matches reports whether ev matches the filter f
+func matches(f key.Filter, ev key.Event) bool {
+	return ev.Name == f.Name && ev.Modifiers.Contain(f.Required) &&
+		ev.Modifiers&^(f.Required|f.Optional) == 0
+}
+
+// processKeys handles the focus and key events of the view
+func (mv *MapView) processKeys(gtx layout.Context) {
+	filters := make([]event.Filter, 0, len(mv.keys.bindings)+1)
+	filters = append(filters, key.FocusFilter{Target: mv})
+	for _, b := range mv.keys.bindings {
+		f := b.Filter
+		f.Focus = mv
+		filters = append(filters, f)
+	}
+	for {
+		ev, ok := gtx.Event(filters...)
+		if !ok {
+			break
+		}
+		switch ev := ev.(type) {
+		case key.FocusEvent:
+			mv.keys.focused = ev.Focus
+			if !ev.Focus {
+				// Releases go elsewhere now
+				clear(mv.keys.held)
+				clear(mv.keys.heldKeys)
+			}
+		case key.Event:
+			mv.key(ev, gtx.Now)
+		}
+	}
+}
+
+// Focused reports whether the view has the keyboard focus
+func (mv *MapView) Focused() bool {
+	return mv.keys.focused
+}
+
+// key handles a key event at now
+func (mv *MapView) key(ev key.Event, now time.Time) {
+	k := &mv.keys
+	if ev.State == key.Release {
+		if action, ok := k.heldKeys[ev.Name]; ok {
+			delete(k.heldKeys, ev.Name)
+			delete(k.held, action)
+		}
+		return
+	}
+	var a KeyAction
+	found := false
+	for _, b := range k.bindings {
+		if matches(b.Filter, ev) {
+			a, found = b.Action, true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+	switch a {
+	case KeyPanUp, KeyPanDown, KeyPanLeft, KeyPanRight, KeyRotateLeft, KeyRotateRight:
+		if _, ok := k.held[a]; ok {
+			// Auto repeat, the frames move the view
+			return
+		}
+		mv.stopMotion()
+		if len(k.held) == 0 {
+			k.lastFrame = now
+		}
+		k.held[a] = now
+		k.heldKeys[ev.Name] = a
+		if d, ok := keyPanDirection(a); ok {
+			mv.panBy(d.Mul(keyPanStep))
+		} else {
+			mv.setBearing(mv.bearing + keyRotateDirection(a)*keyRotateStep)
+		}
+	case KeyPageUp, KeyPageDown:
+		d := f32.Pt(0, float32(mv.size.Y)*keyPage)
+		if a == KeyPageDown {
+			d = d.Mul(-1)
+		}
+		mv.PanTo(mv.screenToLatLng(mv.screenCenter().Sub(d)), 0)
+	case KeyPageLeft, KeyPageRight:
+		d := f32.Pt(float32(mv.size.X)*keyPage, 0)
+		if a == KeyPageRight {
+			d = d.Mul(-1)
+		}
+		mv.PanTo(mv.screenToLatLng(mv.screenCenter().Sub(d)), 0)
+	case KeyZoomIn:
+		mv.ZoomTo(math.Round(mv.zoom)+1, keyZoomDuration)
+	case KeyZoomOut:
+		mv.ZoomTo(math.Round(mv.zoom)-1, keyZoomDuration)
+	case KeyReset:
+		mv.FlyTo(mv.home.center, mv.home.zoom, 0)
+		mv.anim.toBearing = mv.home.bearing
+	}
+	mv.invalidate()
+}
+
+// keyPanDirection returns the direction the content moves for a pan action
+func keyPanDirection(a KeyAction) (f32.Point, bool) {
+	switch a {
+	case KeyPanUp:
+		return f32.Pt(0, 1), true
+	case KeyPanDown:
+		return f32.Pt(0, -1), true
+	case KeyPanLeft:
+		return f32.Pt(1, 0), true
+	case KeyPanRight:
+		return f32.Pt(-1, 0), true
+	}
+	return f32.Point{}, false
+}
+
+// keyRotateDirection returns the sign of the bearing change of a rotate
+// action. Turning the map left shows what is to the right.
+func keyRotateDirection(a KeyAction) float64 {
+	if a == KeyRotateLeft {
+		return 1
+	}
+	return -1
+}
+
+// stepKeys moves the view for the held keys in the frame at now and
+// reports whether it needs another frame
+func (mv *MapView) stepKeys(now time.Time) bool {
+	k := &mv.keys
+	if len(k.held) == 0 {
+		return false
+	}
+	dt := now.Sub(k.lastFrame).Seconds()
+	k.lastFrame = now
+	var pan f32.Point
+	var turn float64
+	for a, since := range k.held {
+		if d, ok := keyPanDirection(a); ok {
+			// The speed ramps up linearly while the key is held
+			held := math.Min(now.Sub(since).Seconds()/keyAccelTime.Seconds(), 1)
+			speed := keyPanSpeed + (keyPanMaxSpeed-keyPanSpeed)*held
+			pan = pan.Add(d.Mul(float32(speed * dt)))
+		} else {
+			turn += keyRotateDirection(a) * keyRotateSpeed * dt
+		}
+	}
+	if turn != 0 {
+		mv.setBearing(mv.bearing + turn)
+	}
+	if pan != (f32.Point{}) {
+		mv.panBy(pan)
+	}
+	return true
+}
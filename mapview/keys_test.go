@@ -0,0 +1,97 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	"gioui.org/io/key"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+func TestKeyPanAccelerates(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	mv.SetView(tiles.LatLng{Lat: 10, Lng: 20}, 8)
+	start := time.Unix(0, 0)
+
+	x0, _ := tiles.CalculateWorldCoordinates(mv.center, mv.zoom)
+	mv.key(key.Event{Name: key.NameRightArrow, State: key.Press}, start)
+	x1, _ := tiles.CalculateWorldCoordinates(mv.center, mv.zoom)
+	if math.Abs(x1-x0-keyPanStep) > 1e-6 {
+		t.Fatalf("press moved %v px east, want %v", x1-x0, keyPanStep)
+	}
+
+	// Auto repeat does not add steps, the frames move the view faster and
+	// faster
+	var moved []float64
+	now := start
+	for i := 0; i < 4; i++ {
+		now = now.Add(500 * time.Millisecond)
+		mv.key(key.Event{Name: key.NameRightArrow, State: key.Press}, now)
+		before, _ := tiles.CalculateWorldCoordinates(mv.center, mv.zoom)
+		if !mv.stepKeys(now) {
+			t.Fatal("no frames while a key is held")
+		}
+		after, _ := tiles.CalculateWorldCoordinates(mv.center, mv.zoom)
+		moved = append(moved, after-before)
+	}
+	if moved[1] <= moved[0] || math.Abs(moved[3]-keyPanMaxSpeed/2) > 1e-6 {
+		t.Errorf("moved %v px per half second, want growing up to %v", moved, keyPanMaxSpeed/2)
+	}
+
+	mv.key(key.Event{Name: key.NameRightArrow, State: key.Release}, now)
+	if mv.stepKeys(now.Add(time.Second)) {
+		t.Error("frames after the key is released")
+	}
+}
+
+func TestKeyRotateAndReset(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	home := mv.center
+	now := time.Unix(0, 0)
+
+	mv.key(key.Event{Name: key.NameRightArrow, Modifiers: key.ModShift, State: key.Press}, now)
+	// Shift is let go first, the release still ends the rotation
+	mv.key(key.Event{Name: key.NameRightArrow, State: key.Release}, now)
+	if mv.Bearing() != 360-keyRotateStep {
+		t.Errorf("bearing %v, want %v", mv.Bearing(), 360-keyRotateStep)
+	}
+	if len(mv.keys.held) != 0 {
+		t.Errorf("held keys %v after release", mv.keys.held)
+	}
+
+	mv.key(key.Event{Name: key.NameDownArrow, State: key.Press}, now)
+	mv.key(key.Event{Name: key.NameDownArrow, State: key.Release}, now)
+	mv.key(key.Event{Name: key.NameHome, State: key.Press}, now)
+	if mv.anim == nil {
+		t.Fatal("Home does not animate")
+	}
+	center, zoom := mv.anim.view(1)
+	if math.Abs(center.Lat-home.Lat) > 1e-9 || math.Abs(center.Lng-home.Lng) > 1e-9 || zoom != 4 || mv.anim.toBearing != 0 {
+		t.Errorf("Home flies to %v zoom %v bearing %v, want the initial view", center, zoom, mv.anim.toBearing)
+	}
+}
+
+func TestKeyBindings(t *testing.T) {
+	mv := NewWithOptions(make(chan struct{}, 1), Options{
+		TileManager: tiles.NewTileManager(tiles.NewLocalTileProvider()),
+		Keys: []KeyBinding{
+			{key.Filter{Name: "W"}, KeyPanUp},
+		},
+	})
+	defer mv.Close()
+	mv.size = image.Pt(800, 600)
+	center := mv.center
+
+	mv.key(key.Event{Name: key.NameUpArrow, State: key.Press}, time.Now())
+	if mv.center != center {
+		t.Error("unbound arrow key moved the view")
+	}
+	mv.key(key.Event{Name: "W", State: key.Press}, time.Now())
+	if mv.center.Lat <= center.Lat {
+		t.Errorf("W moved the center to %v, want north of %v", mv.center, center)
+	}
+}
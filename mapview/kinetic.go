@@ -0,0 +1,162 @@
+package mapview
+
+import (
+	"math"
+	"time"
+
+	"gioui.org/f32"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+// KineticOptions configures the inertia of a pan after the drag is released
+type KineticOptions struct {
+	// Friction is the rate at which the speed decays, per second. The speed
+	// falls to 1/e of the release speed after 1/Friction seconds, and the
+	// map coasts Speed/Friction pixels in total. 4 when zero.
+	Friction float64
+	// MaxSpeed caps the release speed in pixels per second, 5000 when zero
+	MaxSpeed float64
+	// Disabled stops the map dead on release
+	Disabled bool
+}
+
+func (o KineticOptions) withDefaults() KineticOptions {
+	if o.Friction <= 0 {
+		o.Friction = 4
+	}
+	if o.MaxSpeed <= 0 {
+		o.MaxSpeed = 5000
+	}
+	return o
+}
+
+const (
+	// velocityWindow is how far back drag samples count toward the release
+	// velocity
+	velocityWindow = 100 * time.Millisecond
+	// kineticMinSpeed ends the coasting, in pixels per second
+	kineticMinSpeed = 10
+)
+
+// kinetic estimates the pointer velocity during a drag and carries the pan
+// on with exponential decay after release
+type kinetic struct {
+	opts    KineticOptions
+	samples []dragSample
+	// velocity is how fast the map content moves on screen, in pixels per
+	// second, while active
+	velocity  f32.Point
+	active    bool
+	lastFrame time.Time
+}
+
+type dragSample struct {
+	pos f32.Point
+	t   time.Duration
+}
+
+// start begins tracking a drag, stopping any coasting
+func (k *kinetic) start(pos f32.Point, t time.Duration) {
+	k.stop()
+	k.samples = append(k.samples[:0], dragSample{pos: pos, t: t})
+}
+
+// track records the pointer position of a drag event at the event time t
+func (k *kinetic) track(pos f32.Point, t time.Duration) {
+	k.samples = append(k.samples, dragSample{pos: pos, t: t})
+	// Only the samples in the velocity window are needed
+	i := 0
+	for i < len(k.samples)-2 && t-k.samples[i+1].t > velocityWindow {
+		i++
+	}
+	k.samples = append(k.samples[:0], k.samples[i:]...)
+}
+
+// release starts coasting with the velocity of the drag ending at t
+func (k *kinetic) release(t time.Duration) {
+	k.velocity = k.estimate(t)
+	k.samples = k.samples[:0]
+	k.lastFrame = time.Time{}
+	k.active = !k.opts.Disabled && math.Hypot(float64(k.velocity.X), float64(k.velocity.Y)) >= kineticMinSpeed
+}
+
+// estimate returns the drag velocity at t over the samples in the velocity
+// window. A pointer held still before release has none.
+func (k *kinetic) estimate(t time.Duration) f32.Point {
+	if len(k.samples) < 2 {
+		return f32.Point{}
+	}
+	last := k.samples[len(k.samples)-1]
+	if t-last.t > velocityWindow/2 {
+		return f32.Point{}
+	}
+	first := k.samples[0]
+	for _, s := range k.samples {
+		if last.t-s.t <= velocityWindow {
+			first = s
+			break
+		}
+	}
+	dt := (last.t - first.t).Seconds()
+	if dt <= 0 {
+		return f32.Point{}
+	}
+	v := last.pos.Sub(first.pos).Mul(float32(1 / dt))
+	if speed := math.Hypot(float64(v.X), float64(v.Y)); speed > k.opts.MaxSpeed {
+		v = v.Mul(float32(k.opts.MaxSpeed / speed))
+	}
+	return v
+}
+
+func (k *kinetic) stop() {
+	k.active = false
+	k.velocity = f32.Point{}
+}
+
+// step returns how far the content moves on screen in the frame at now and
+// whether the coasting goes on
+func (k *kinetic) step(now time.Time) (f32.Point, bool) {
+	if !k.active {
+		return f32.Point{}, false
+	}
+	if k.lastFrame.IsZero() {
+		// The first frame only starts the clock
+		k.lastFrame = now
+		return f32.Point{}, true
+	}
+	dt := now.Sub(k.lastFrame).Seconds()
+	k.lastFrame = now
+	// Integrate v·exp(-friction·t) over the frame exactly, so that the
+	// distance does not depend on the frame rate
+	decay := math.Exp(-k.opts.Friction * dt)
+	d := k.velocity.Mul(float32((1 - decay) / k.opts.Friction))
+	k.velocity = k.velocity.Mul(float32(decay))
+	if math.Hypot(float64(k.velocity.X), float64(k.velocity.Y)) < kineticMinSpeed {
+		k.stop()
+	}
+	return d, k.active
+}
+
+// panBy moves the map content by d screen pixels
+func (mv *MapView) panBy(d f32.Point) {
+	x, y := tiles.CalculateWorldCoordinates(mv.center, mv.zoom)
+	d = mv.toMap(d)
+	x -= float64(d.X)
+	y -= float64(d.Y)
+	mv.setView(tiles.WorldToLatLng(x, y, mv.zoom), mv.zoom)
+}
+
+// stepKinetic coasts the pan for the frame at now and reports whether it
+// needs another frame
+func (mv *MapView) stepKinetic(now time.Time) bool {
+	if !mv.kinetic.active {
+		return false
+	}
+	d, more := mv.kinetic.step(now)
+	// The view center moves against the content, prefetch looks that way
+	mv.panVelocity = mv.kinetic.velocity.Mul(-1)
+	if d != (f32.Point{}) {
+		mv.panBy(d)
+	}
+	return more
+}
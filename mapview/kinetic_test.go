@@ -0,0 +1,111 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	"gioui.org/f32"
+)
+
+// drag feeds k a drag moving by step pixels every 10ms for n events and
+// returns the time of the last one
+func drag(k *kinetic, step f32.Point, n int) time.Duration {
+	var t time.Duration
+	pos := f32.Pt(100, 100)
+	k.start(pos, t)
+	for i := 0; i < n; i++ {
+		t += 10 * time.Millisecond
+		pos = pos.Add(step)
+		k.track(pos, t)
+	}
+	return t
+}
+
+// coast steps k at 60 frames per second until it stops and returns the
+// total distance
+func coast(t *testing.T, k *kinetic) f32.Point {
+	var total f32.Point
+	now := time.Unix(0, 0)
+	for frame := 0; ; frame++ {
+		if frame > 10000 {
+			t.Fatal("coasting never stops")
+		}
+		d, more := k.step(now)
+		total = total.Add(d)
+		if !more {
+			return total
+		}
+		now = now.Add(16 * time.Millisecond)
+	}
+}
+
+func TestKineticCoasts(t *testing.T) {
+	k := kinetic{opts: KineticOptions{}.withDefaults()}
+	// 10px every 10ms is 1000px/s to the right
+	end := drag(&k, f32.Pt(10, 0), 20)
+	k.release(end + 5*time.Millisecond)
+	if !k.active {
+		t.Fatal("no coasting after a fast drag")
+	}
+	if math.Abs(float64(k.velocity.X)-1000) > 1 || k.velocity.Y != 0 {
+		t.Fatalf("release velocity %v, want 1000px/s right", k.velocity)
+	}
+	// The distance is speed/friction, less the tail below the minimum speed
+	d := coast(t, &k)
+	if d.X < 240 || d.X > 250 || d.Y != 0 {
+		t.Errorf("coasted %v, want about 250px right", d)
+	}
+}
+
+func TestKineticMaxSpeed(t *testing.T) {
+	k := kinetic{opts: KineticOptions{MaxSpeed: 500}.withDefaults()}
+	end := drag(&k, f32.Pt(0, -50), 10)
+	k.release(end)
+	if math.Abs(float64(k.velocity.Y)+500) > 1e-3 || k.velocity.X != 0 {
+		t.Errorf("release velocity %v, want capped at 500px/s up", k.velocity)
+	}
+}
+
+func TestKineticStopsWithoutMotion(t *testing.T) {
+	for name, opts := range map[string]KineticOptions{
+		"held":     {},
+		"disabled": {Disabled: true},
+	} {
+		k := kinetic{opts: opts.withDefaults()}
+		end := drag(&k, f32.Pt(10, 10), 20)
+		if name == "held" {
+			// The pointer rests before it is lifted
+			end += 200 * time.Millisecond
+		}
+		k.release(end)
+		if k.active {
+			t.Errorf("%s: coasting after release", name)
+		}
+	}
+}
+
+func TestPressStopsCoasting(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	end := drag(&mv.kinetic, f32.Pt(10, 0), 20)
+	mv.kinetic.release(end)
+
+	now := time.Unix(0, 0)
+	center := mv.center
+	for i := 0; i < 3; i++ {
+		mv.stepKinetic(now)
+		now = now.Add(16 * time.Millisecond)
+	}
+	// Content moving right means the view center moves west
+	if mv.center.Lng >= center.Lng {
+		t.Fatalf("center %v did not coast west of %v", mv.center, center)
+	}
+
+	mv.kinetic.start(f32.Pt(400, 300), end+time.Second)
+	center = mv.center
+	if mv.stepKinetic(now.Add(16*time.Millisecond)) || mv.center != center {
+		t.Error("view still coasting after a press")
+	}
+}
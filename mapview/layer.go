@@ -0,0 +1,75 @@
+package mapview
+
+import (
+	"image"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+// Layer draws over the tiles of a MapView, with the projection of the frame
+// to place its content. Layers may handle pointer events of their own; a
+// layer that grabs the pointer keeps the map from panning.
+type Layer interface {
+	Layout(gtx layout.Context, proj Projection)
+}
+
+// AddLayer draws l over the tiles and the layers added before it
+func (mv *MapView) AddLayer(l Layer) {
+	mv.layers = append(mv.layers, l)
+	mv.invalidate()
+}
+
+// RemoveLayer stops drawing l
+func (mv *MapView) RemoveLayer(l Layer) {
+	for i, layer := range mv.layers {
+		if layer == l {
+			mv.layers = append(mv.layers[:i], mv.layers[i+1:]...)
+			mv.invalidate()
+			return
+		}
+	}
+}
+
+// Projection converts between geographical and screen coordinates for a
+// view of the map
+type Projection struct {
+	Center tiles.LatLng
+	// Zoom is the fractional zoom level
+	Zoom float64
+	// Bearing is the compass direction at the top of the view, in degrees
+	Bearing float64
+	// Size is the view size in pixels
+	Size image.Point
+}
+
+// Projection returns the current projection of the view
+func (mv *MapView) Projection() Projection {
+	return Projection{Center: mv.center, Zoom: mv.zoom, Bearing: mv.bearing, Size: mv.size}
+}
+
+// ToScreen returns the position of ll in the view
+func (p Projection) ToScreen(ll tiles.LatLng) f32.Point {
+	cx, cy := tiles.CalculateWorldCoordinates(p.Center, p.Zoom)
+	x, y := tiles.CalculateWorldCoordinates(ll, p.Zoom)
+	d := f32.Pt(float32(x-cx), float32(y-cy))
+	if p.Bearing != 0 {
+		d = rotate(d, -p.Bearing)
+	}
+	return p.screenCenter().Add(d)
+}
+
+// FromScreen returns the geographical coordinates of the view position pos
+func (p Projection) FromScreen(pos f32.Point) tiles.LatLng {
+	x, y := tiles.CalculateWorldCoordinates(p.Center, p.Zoom)
+	d := pos.Sub(p.screenCenter())
+	if p.Bearing != 0 {
+		d = rotate(d, p.Bearing)
+	}
+	return tiles.WorldToLatLng(x+float64(d.X), y+float64(d.Y), p.Zoom)
+}
+
+func (p Projection) screenCenter() f32.Point {
+	return f32.Pt(float32(p.Size.X>>1), float32(p.Size.Y>>1))
+}
@@ -5,9 +5,12 @@ import (
 	"image"
 	"log"
 	"math"
+	"sync"
+	"time"
 
 	"gioui.org/f32"
 	"gioui.org/io/event"
+	"gioui.org/io/key"
 	"gioui.org/io/pointer"
 	"gioui.org/layout"
 	"gioui.org/op"
@@ -25,8 +28,10 @@ const (
 
 type MapView struct {
 	tileManager    *tiles.TileManager
+	ownsManager    bool // the TileManager was created by NewWithOptions
 	center         tiles.LatLng
 	zoom           float64 // Changed to float64 for smooth zooming
+	bearing        float64 // Compass direction at the top of the view, in degrees
 	targetZoom     int     // The nearest integer zoom level for tile loading
 	prevZoom       int     // Previous integer zoom level for scaling old tiles
 	minZoom        int
@@ -37,82 +42,152 @@ type MapView struct {
 	prevTiles      []tiles.Tile // Previous zoom level tiles
 	metersPerPixel float64
 	//
-	clickPos      f32.Point
-	dragging      bool
-	lastDragPos   f32.Point
-	released      bool
+	clickPos    f32.Point
+	dragging    bool
+	lastDragPos f32.Point
+	released    bool
+	cursor      f32.Point
+	hovering    bool
+	focusTile   tiles.Tile
+	// clickZoom handles double-click and Shift drag zooming
+	clickZoom          clickZoom
+	disableDoubleClick bool
+	disableBoxZoom     bool
+	// rotatingDrag is set while a right button or Ctrl drag turns the map
+	rotatingDrag bool
+	lastRotate   f32.Point
+	// now is the time of the frame being handled
+	now time.Time
+	// panVelocity is how fast a drag moves the view center, in pixels per
+	// second, and lastPan when it last moved
+	panVelocity f32.Point
+	lastPan     time.Time
+	// zoomDirection is the sign of the last scroll zoom, kept until
+	// zoomIdle after lastZoom, with zoomAnchor under the cursor
+	zoomDirection int
+	zoomAnchor    tiles.LatLng
+	lastZoom      time.Time
+	// anim is the running camera animation, pendingFit a FitBounds
+	// waiting for the view size
+	anim       *animation
+	pendingFit *fit
+	scrollZoom scrollZoom
+	kinetic    kinetic
+	// gestures recognizes touch gestures, touchPointers is the number of
+	// pointers of the last one
+	gestures      gestureRecognizer
+	touchPointers int
+	// layers are drawn over the tiles, in order
+	layers []Layer
+	// keys is the keyboard state, home the view the reset key returns to
+	keys          keyboard
+	home          view
 	refresh       chan struct{}
 	currentCtx    context.Context
 	cancelCurrent context.CancelFunc
+	// onScreen is the set of drawn tiles that tile events repaint for, it
+	// is read by the loading goroutines
+	onScreen    map[tiles.Tile]bool
+	onScreenMu  sync.Mutex
+	unsubscribe func()
+	// placeholders holds the ops of tiles drawn while not loaded, along
+	// with the image they were made from
+	placeholders map[tiles.Tile]placeholder
 }
 
+type placeholder struct {
+	img image.Image
+	op  paint.ImageOp
+}
+
+// zoomIdle is how long after the last scroll the view counts as zooming,
+// for prefetching
+const zoomIdle = 300 * time.Millisecond
+
 func (mv *MapView) Update(gtx layout.Context) {
 	tag := mv
+	mv.now = gtx.Now
 
 	// process events
 	dragDelta := f32.Point{}
 	for {
 		ev, ok := gtx.Event(pointer.Filter{
-			Target:  tag,
-			Kinds:   pointer.Scroll | pointer.Drag | pointer.Press | pointer.Release | pointer.Cancel,
-			ScrollY: pointer.ScrollRange{Min: -10, Max: 10},
+			Target: tag,
+			Kinds: pointer.Scroll | pointer.Drag | pointer.Press | pointer.Release | pointer.Cancel |
+				pointer.Move | pointer.Enter | pointer.Leave,
+			// Wide enough to tell wheel notches from trackpad deltas
+			ScrollY: pointer.ScrollRange{Min: -1 << 20, Max: 1 << 20},
 		})
 		if !ok {
 			break
 		}
 
 		if x, ok := ev.(pointer.Event); ok {
+			if x.Kind == pointer.Press {
+				// Clicking the map gives it the keyboard
+				gtx.Execute(key.FocusCmd{Tag: tag})
+			}
+			if x.Source == pointer.Touch {
+				mv.touch(x)
+				continue
+			}
 			switch x.Kind {
+			case pointer.Move, pointer.Enter:
+				mv.cursor = x.Position
+				mv.hovering = true
+				mv.updateFocus()
+			case pointer.Leave:
+				mv.hovering = false
+				mv.updateFocus()
 			case pointer.Press:
+				// The user takes over from animations and coasting
+				mv.stopMotion()
+				if rotating(x) {
+					mv.rotatingDrag = true
+					mv.lastRotate = x.Position
+					break
+				}
+				if mv.clickPress(x) {
+					break
+				}
+				mv.kinetic.start(x.Position, x.Time)
 				mv.clickPos = x.Position
 				mv.dragging = true
 			case pointer.Scroll:
-				log.Println("pointer.Scroll", x.Scroll.Y)
-				// Get mouse position relative to screen center
-				screenCenterX := float64(mv.size.X >> 1)
-				screenCenterY := float64(mv.size.Y >> 1)
-				mouseOffsetX := float64(x.Position.X) - screenCenterX
-				mouseOffsetY := float64(x.Position.Y) - screenCenterY
-
-				// Convert screen coordinates to world coordinates at current zoom
-				worldX, worldY := tiles.CalculateWorldCoordinates(mv.center, mv.zoom)
-				mouseWorldX := worldX + mouseOffsetX
-				mouseWorldY := worldY + mouseOffsetY
-
-				// Update zoom level smoothly
-				zoomDelta := float64(x.Scroll.Y) * -0.015 // Smaller increment for smoother zoom
-				newZoom := mv.zoom + zoomDelta
-				newZoom = math.Max(float64(mv.minZoom), math.Min(newZoom, float64(mv.maxZoom)))
-
-				// If zoom changed, adjust center to keep mouse position fixed
-				if newZoom != mv.zoom {
-					log.Println("newZoom", newZoom)
-					// Calculate the new world coordinates after zoom
-					zoomFactor := math.Pow(2, newZoom-mv.zoom)
-					mv.zoom = newZoom
-					mv.targetZoom = int(math.Round(mv.zoom))
-					newWorldX := mouseWorldX * zoomFactor
-					newWorldY := mouseWorldY * zoomFactor
-
-					// Calculate where the new center should be
-					newWorldCenterX := newWorldX - mouseOffsetX
-					newWorldCenterY := newWorldY - mouseOffsetY
-
-					// Convert back to geographical coordinates
-					mv.center = tiles.WorldToLatLng(newWorldCenterX, newWorldCenterY, mv.zoom)
-
-					mv.updateVisibleTiles()
+				mv.anim = nil
+				if x.Scroll.Y == 0 {
+					break
 				}
-				x.Scroll = f32.Point{}
+				mv.zoomDirection = 1
+				if x.Scroll.Y > 0 {
+					mv.zoomDirection = -1
+				}
+				mv.zoomAnchor = mv.screenToLatLng(x.Position)
+				mv.lastZoom = gtx.Now
+				// The zoom moves toward the new target over the next frames
+				mv.scrollZoom.scroll(x, mv.zoom, mv.zoomAnchor, gtx.Now)
 
 			case pointer.Drag:
+				if mv.clickDrag(x) {
+					break
+				}
+				if mv.rotatingDrag {
+					mv.rotateDrag(mv.lastRotate, x.Position)
+					mv.lastRotate = x.Position
+					break
+				}
 				dragDelta = x.Position.Sub(mv.clickPos)
+				mv.kinetic.track(x.Position, x.Time)
 				log.Println("pointer.Drag", dragDelta)
-			case pointer.Release:
-				fallthrough
-			case pointer.Cancel:
+			case pointer.Release, pointer.Cancel:
+				if mv.dragging && x.Kind == pointer.Release {
+					mv.kinetic.release(x.Time)
+				}
+				mv.clickRelease(x)
+				mv.rotatingDrag = false
 				mv.dragging = false
 				mv.released = true
+				mv.panVelocity = f32.Point{}
 			}
 		}
 	}
@@ -123,9 +198,9 @@ func (mv *MapView) Update(gtx layout.Context) {
 			mv.released = false
 		}
 		if dragDelta != mv.lastDragPos {
-			// Calculate the delta from last position
-			deltaX := dragDelta.X - mv.lastDragPos.X
-			deltaY := dragDelta.Y - mv.lastDragPos.Y
+			// Calculate the delta from last position, in the north-up frame
+			delta := mv.toMap(dragDelta.Sub(mv.lastDragPos))
+			deltaX, deltaY := delta.X, delta.Y
 
 			// Adjust delta based on current zoom scale
 			scale := math.Pow(2, mv.zoom-float64(mv.targetZoom))
@@ -136,6 +211,13 @@ func (mv *MapView) Update(gtx layout.Context) {
 			latChange := adjustedDeltaY * mv.metersPerPixel / 111319.9
 			lngChange := -adjustedDeltaX * mv.metersPerPixel / (111319.9 * math.Cos(mv.center.Lat*math.Pi/180))
 
+			// The view center moves against the drag
+			if dt := gtx.Now.Sub(mv.lastPan).Seconds(); dt > 0 && dt < 0.1 {
+				v := dragDelta.Sub(mv.lastDragPos).Mul(float32(-1 / dt))
+				mv.panVelocity = mv.panVelocity.Add(v).Mul(0.5)
+			}
+			mv.lastPan = gtx.Now
+
 			mv.center.Lat += latChange
 			mv.center.Lng += lngChange
 			mv.updateVisibleTiles()
@@ -146,8 +228,27 @@ func (mv *MapView) Update(gtx layout.Context) {
 	// Update size if changed
 	if mv.size != gtx.Constraints.Max {
 		mv.size = gtx.Constraints.Max
+		if f := mv.pendingFit; f != nil {
+			mv.pendingFit = nil
+			center, zoom := mv.fitView(f.bounds, f.padding)
+			mv.setView(center, zoom)
+		}
 		mv.updateVisibleTiles()
 	}
+
+	mv.processKeys(gtx)
+
+	more := mv.stepScrollZoom(gtx.Now)
+	if mv.stepKinetic(gtx.Now) {
+		more = true
+	}
+	if mv.stepKeys(gtx.Now) {
+		more = true
+	}
+	if more {
+		gtx.Execute(op.InvalidateCmd{})
+	}
+	mv.animate(gtx)
 }
 
 func (mv *MapView) Layout(gtx layout.Context) layout.Dimensions {
@@ -162,35 +263,35 @@ func (mv *MapView) Layout(gtx layout.Context) layout.Dimensions {
 	defer clip.Rect{Max: gtx.Constraints.Max}.Push(gtx.Ops).Pop()
 	event.Op(gtx.Ops, tag)
 
+	// Tiles are laid out north-up and turned around the view center, over
+	// the north-up box around the view
+	area := mv.tileArea()
+	minX, minY := (mv.size.X-area.X)/2, (mv.size.Y-area.Y)/2
+	maxX, maxY := minX+area.X, minY+area.Y
+	rot := op.Affine(f32.Affine2D{}.Rotate(mv.screenCenter(), float32(-mv.bearing*math.Pi/180))).Push(gtx.Ops)
+
 	// Draw previous zoom level tiles first if we're between zoom levels
 	if math.Abs(mv.zoom-float64(mv.targetZoom)) > 0.01 && len(mv.prevTiles) > 0 {
 		prevScale := math.Pow(2, mv.zoom-float64(mv.prevZoom))
 		for _, tile := range mv.prevTiles {
-			var imageOp paint.ImageOp
-			key := tiles.GetTileKey(tile)
-
-			if cached, ok := mv.tileManager.GetCache().Get(key); ok {
-				if imgOp, ok := cached.(paint.ImageOp); ok {
-					imageOp = imgOp
-
-					// Calculate positions for previous zoom level tiles
-					centerWorldPx, centerWorldPy := tiles.CalculateWorldCoordinates(mv.center, float64(mv.prevZoom))
-					screenCenterX := mv.size.X >> 1
-					screenCenterY := mv.size.Y >> 1
-					tileWorldPx := float64(tile.X * tiles.TileSize)
-					tileWorldPy := float64(tile.Y * tiles.TileSize)
-					finalX := screenCenterX + int(tileWorldPx-centerWorldPx)
-					finalY := screenCenterY + int(tileWorldPy-centerWorldPy)
-
-					if finalX+tiles.TileSize >= 0 && finalX <= mv.size.X &&
-						finalY+tiles.TileSize >= 0 && finalY <= mv.size.Y {
-						transformStack := op.Offset(image.Point{X: finalX, Y: finalY}).Push(gtx.Ops)
-						scaleStack := op.Affine(f32.Affine2D{}.Scale(f32.Point{}, f32.Point{X: float32(prevScale), Y: float32(prevScale)})).Push(gtx.Ops)
-						imageOp.Add(gtx.Ops)
-						paint.PaintOp{}.Add(gtx.Ops)
-						scaleStack.Pop()
-						transformStack.Pop()
-					}
+			if imageOp, ok := mv.tileManager.ImageOp(tile); ok {
+				// Calculate positions for previous zoom level tiles
+				centerWorldPx, centerWorldPy := tiles.CalculateWorldCoordinates(mv.center, float64(mv.prevZoom))
+				screenCenterX := mv.size.X >> 1
+				screenCenterY := mv.size.Y >> 1
+				tileWorldPx := float64(tile.X * tiles.TileSize)
+				tileWorldPy := float64(tile.Y * tiles.TileSize)
+				finalX := screenCenterX + int(tileWorldPx-centerWorldPx)
+				finalY := screenCenterY + int(tileWorldPy-centerWorldPy)
+
+				if finalX+tiles.TileSize >= minX && finalX <= maxX &&
+					finalY+tiles.TileSize >= minY && finalY <= maxY {
+					transformStack := op.Offset(image.Point{X: finalX, Y: finalY}).Push(gtx.Ops)
+					scaleStack := op.Affine(f32.Affine2D{}.Scale(f32.Point{}, f32.Point{X: float32(prevScale), Y: float32(prevScale)})).Push(gtx.Ops)
+					imageOp.Add(gtx.Ops)
+					paint.PaintOp{}.Add(gtx.Ops)
+					scaleStack.Pop()
+					transformStack.Pop()
 				}
 			}
 		}
@@ -199,23 +300,14 @@ func (mv *MapView) Layout(gtx layout.Context) layout.Dimensions {
 	// Draw current zoom level tiles
 	baseScale = math.Pow(2, mv.zoom-float64(mv.targetZoom))
 	for _, tile := range mv.visibleTiles {
-		var imageOp paint.ImageOp
-		key := tiles.GetTileKey(tile)
-
 		// Try to get from cache first
-		if cached, ok := mv.tileManager.GetCache().Get(key); ok {
-			if imgOp, ok := cached.(paint.ImageOp); ok {
-				imageOp = imgOp
-			}
-		} else {
-			// If not in cache, load and cache it
-			img, err := mv.tileManager.GetTile(tile)
-			if err != nil {
-				log.Printf("Error loading tile %v: %v", tile, err)
+		imageOp, ok := mv.tileManager.ImageOp(tile)
+		if !ok {
+			// If not in cache, start loading it and draw the placeholder
+			imageOp, ok = mv.placeholder(tile)
+			if !ok {
 				continue
 			}
-			imageOp = paint.NewImageOp(img)
-			mv.tileManager.GetCache().Set(key, imageOp)
 		}
 
 		// Calculate positions with fractional precision
@@ -232,8 +324,8 @@ func (mv *MapView) Layout(gtx layout.Context) layout.Dimensions {
 
 		// Draw only if tile is visible
 		scaledTileSize := int(float64(tiles.TileSize) * baseScale)
-		if finalX+scaledTileSize >= 0 && finalX <= mv.size.X &&
-			finalY+scaledTileSize >= 0 && finalY <= mv.size.Y {
+		if finalX+scaledTileSize >= minX && finalX <= maxX &&
+			finalY+scaledTileSize >= minY && finalY <= maxY {
 			transformStack := op.Offset(image.Point{X: finalX, Y: finalY}).Push(gtx.Ops)
 			scaleStack := op.Affine(f32.Affine2D{}.Scale(f32.Point{}, f32.Point{X: float32(baseScale), Y: float32(baseScale)})).Push(gtx.Ops)
 			imageOp.Add(gtx.Ops)
@@ -243,40 +335,156 @@ func (mv *MapView) Layout(gtx layout.Context) layout.Dimensions {
 		}
 	}
 
+	rot.Pop()
+
+	proj := mv.Projection()
+	for _, l := range mv.layers {
+		l.Layout(gtx, proj)
+	}
+	mv.layoutBox(gtx)
 	return layout.Dimensions{Size: mv.size}
 }
 
+// Options configures a MapView
+type Options struct {
+	// TileManager supplies the tiles, an OSM manager with local fallback
+	// tiles when nil. A TileManager passed in is not closed by Close, so it
+	// can be shared between views.
+	TileManager *tiles.TileManager
+	// Center and Zoom are the initial view, London at zoom 4 when both are
+	// zero
+	Center tiles.LatLng
+	Zoom   float64
+	// Bearing is the initial compass direction at the top of the view, in
+	// degrees clockwise from north
+	Bearing float64
+	// MinZoom and MaxZoom bound the zoom level, 0 and 19 when zero
+	MinZoom, MaxZoom int
+	// Keys are the key bindings of the view, DefaultKeyBindings when nil.
+	// An empty slice turns the keyboard off.
+	Keys []KeyBinding
+	// DisableDoubleClickZoom turns off zooming in by double-click, and out
+	// by Shift or Alt double-click
+	DisableDoubleClickZoom bool
+	// DisableBoxZoom turns off zooming to a rectangle drawn by Shift drag
+	DisableBoxZoom bool
+	// ScrollZoom configures zooming with the mouse wheel and trackpad
+	ScrollZoom ScrollZoomOptions
+	// Kinetic configures the inertia of a pan after the drag is released
+	Kinetic KineticOptions
+}
+
 func New(refresh chan struct{}) *MapView {
-	tm := tiles.NewTileManager(
-		tiles.NewCombinedTileProvider(
-			tiles.NewOSMTileProvider(),
-			tiles.NewLocalTileProvider(),
-		),
-		tiles.CacheImageOp,
-	)
-	tm.SetOnLoadCallback(func() {
-		log.Println("onLoad")
-		// Non-blocking send to refresh channel
-		select {
-		case refresh <- struct{}{}:
-		default:
-		}
-	})
+	return NewWithOptions(refresh, Options{})
+}
 
-	return &MapView{
+func NewWithOptions(refresh chan struct{}, opts Options) *MapView {
+	tm := opts.TileManager
+	owns := tm == nil
+	if owns {
+		tm = tiles.NewTileManager(
+			tiles.NewCombinedTileProvider(
+				tiles.NewOSMTileProvider(),
+				tiles.NewLocalTileProvider(),
+			),
+		)
+	}
+	if opts.Center == (tiles.LatLng{}) && opts.Zoom == 0 {
+		opts.Center = tiles.LatLng{Lat: initialLatitude, Lng: initialLongitude} // London
+		opts.Zoom = 4
+	}
+	if opts.MaxZoom <= 0 {
+		opts.MaxZoom = 19
+	}
+	opts.Zoom = math.Max(float64(opts.MinZoom), math.Min(opts.Zoom, float64(opts.MaxZoom)))
+	keys := opts.Keys
+	if keys == nil {
+		keys = DefaultKeyBindings
+	}
+	mv := &MapView{
 		tileManager: tm,
-		center:      tiles.LatLng{Lat: initialLatitude, Lng: initialLongitude}, // London
-		zoom:        4.0,
-		targetZoom:  4,
-		prevZoom:    4,
-		minZoom:     0,
-		maxZoom:     19,
+		ownsManager: owns,
+		center:      opts.Center,
+		zoom:        opts.Zoom,
+		bearing:     normalizeBearing(opts.Bearing),
+		targetZoom:  int(math.Round(opts.Zoom)),
+		prevZoom:    int(math.Round(opts.Zoom)),
+		minZoom:     opts.MinZoom,
+		maxZoom:     opts.MaxZoom,
+		refresh:     refresh,
 		list: &widget.List{
 			List: layout.List{
 				Axis: layout.Vertical,
 			},
 		},
+		placeholders: make(map[tiles.Tile]placeholder),
+		scrollZoom:   scrollZoom{opts: opts.ScrollZoom.withDefaults()},
+		kinetic:      kinetic{opts: opts.Kinetic.withDefaults()},
+		keys: keyboard{
+			bindings: keys,
+			held:     make(map[KeyAction]time.Time),
+			heldKeys: make(map[key.Name]KeyAction),
+		},
+		disableDoubleClick: opts.DisableDoubleClickZoom,
+		disableBoxZoom:     opts.DisableBoxZoom,
+		home:               view{center: opts.Center, zoom: opts.Zoom, bearing: normalizeBearing(opts.Bearing)},
 	}
+	mv.unsubscribe = tm.Subscribe(func(ev tiles.TileEvent) {
+		var tile tiles.Tile
+		switch ev := ev.(type) {
+		case tiles.TileLoaded:
+			tile = ev.Tile
+		case tiles.TileFailed:
+			tile = ev.Tile
+		default:
+			// Tiles on screen are pinned and never evicted
+			return
+		}
+		mv.onScreenMu.Lock()
+		visible := mv.onScreen[tile]
+		mv.onScreenMu.Unlock()
+		if !visible {
+			return
+		}
+		// Non-blocking send to refresh channel
+		select {
+		case refresh <- struct{}{}:
+		default:
+		}
+	})
+	return mv
+}
+
+// placeholder returns the op to draw for a tile that is not loaded, an
+// error tile for failed tiles and the fallback tile otherwise. Ops are
+// reused while GetTile returns the same image, so that their textures are
+// not uploaded every frame.
+func (mv *MapView) placeholder(tile tiles.Tile) (paint.ImageOp, bool) {
+	img, err := mv.tileManager.GetTile(tile)
+	if err != nil {
+		log.Printf("Error loading tile %v: %v", tile, err)
+		return paint.ImageOp{}, false
+	}
+	if p, ok := mv.placeholders[tile]; ok && p.img == img {
+		return p.op, true
+	}
+	op := paint.NewImageOp(img)
+	mv.placeholders[tile] = placeholder{img: img, op: op}
+	return op, true
+}
+
+// Close stops the view's pending tile loads and tile events. The
+// TileManager is closed too unless it was passed in Options. Close may be
+// called more than once.
+func (mv *MapView) Close() error {
+	if mv.cancelCurrent != nil {
+		mv.cancelCurrent()
+	}
+	mv.unsubscribe()
+	if !mv.ownsManager {
+		return nil
+	}
+	return mv.tileManager.Close()
 }
 
 func (mv *MapView) updateVisibleTiles() {
@@ -294,7 +502,30 @@ func (mv *MapView) updateVisibleTiles() {
 		mv.targetZoom = newTargetZoom
 	}
 
-	mv.visibleTiles = tiles.CalculateVisibleTiles(mv.center, mv.targetZoom, mv.size)
+	mv.visibleTiles = tiles.CalculateVisibleTiles(mv.center, mv.targetZoom, mv.tileArea())
+
+	// Keep the tiles on screen, including the ones still drawn from the
+	// previous zoom level, from being evicted
+	pinned := make([]tiles.Tile, 0, len(mv.visibleTiles)+len(mv.prevTiles))
+	pinned = append(pinned, mv.visibleTiles...)
+	pinned = append(pinned, mv.prevTiles...)
+	mv.tileManager.SetPinned(pinned)
+
+	onScreen := make(map[tiles.Tile]bool, len(pinned))
+	for _, tile := range pinned {
+		onScreen[tile] = true
+	}
+	mv.onScreenMu.Lock()
+	mv.onScreen = onScreen
+	mv.onScreenMu.Unlock()
+	for tile := range mv.placeholders {
+		if !onScreen[tile] {
+			delete(mv.placeholders, tile)
+		}
+	}
+
+	mv.updateFocus()
+	mv.prefetch()
 
 	ctx := mv.currentCtx
 	for _, tile := range mv.visibleTiles {
@@ -304,3 +535,45 @@ func (mv *MapView) updateVisibleTiles() {
 		go mv.tileManager.GetTile(tile)
 	}
 }
+
+// prefetch asks the TileManager for the tiles ahead of the current pan
+// and zoom
+func (mv *MapView) prefetch() {
+	velocity := mv.toMap(mv.panVelocity)
+	v := tiles.Viewport{
+		Center:   mv.center,
+		Zoom:     mv.zoom,
+		Size:     mv.tileArea(),
+		Velocity: image.Pt(int(velocity.X), int(velocity.Y)),
+	}
+	if mv.now.Sub(mv.lastZoom) < zoomIdle {
+		v.ZoomDirection = mv.zoomDirection
+		v.Anchor = mv.zoomAnchor
+	}
+	mv.tileManager.Prefetch(v)
+}
+
+// screenToLatLng converts a position in the view to geographical coordinates
+func (mv *MapView) screenToLatLng(pos f32.Point) tiles.LatLng {
+	return mv.Projection().FromScreen(pos)
+}
+
+// screenCenter returns the center of the view in screen coordinates
+func (mv *MapView) screenCenter() f32.Point {
+	return f32.Pt(float32(mv.size.X>>1), float32(mv.size.Y>>1))
+}
+
+// updateFocus points tile loading at the tile under the cursor, or at the
+// view center when the cursor is outside the map
+func (mv *MapView) updateFocus() {
+	focus := mv.center
+	if mv.hovering {
+		focus = mv.screenToLatLng(mv.cursor)
+	}
+	tile := tiles.LatLngToTile(focus, mv.targetZoom)
+	if tile == mv.focusTile {
+		return
+	}
+	mv.focusTile = tile
+	mv.tileManager.SetViewport(focus, mv.targetZoom)
+}
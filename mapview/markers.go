@@ -0,0 +1,253 @@
+package mapview
+
+import (
+	"image"
+	"sort"
+	"sync"
+
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+// Marker is a widget or icon pinned to a geographical position
+type Marker struct {
+	Position tiles.LatLng
+	// Anchor is the point of the marker placed at Position, as a fraction
+	// of its size. The zero value is the top left corner, (0.5, 1) the
+	// bottom center of a pin.
+	Anchor f32.Point
+	// ZIndex orders the markers, higher ones are drawn on top. Markers with
+	// the same ZIndex are drawn in the order they were added.
+	ZIndex int
+	// Widget draws the marker, Icon is drawn when it is nil
+	Widget layout.Widget
+	Icon   image.Image
+	// Draggable markers can be moved with the pointer, OnDragEnd is then
+	// called with the new position
+	Draggable bool
+	OnDragEnd func(tiles.LatLng)
+}
+
+// MarkerLayer is a Layer of markers identified by string IDs. Its methods
+// may be called from any goroutine; changes made outside the UI goroutine
+// show on the next frame, so the window should be invalidated.
+type MarkerLayer struct {
+	mu      sync.Mutex
+	markers map[string]*markerState
+	seq     uint64
+}
+
+type markerState struct {
+	marker Marker
+	seq    uint64
+	// The fields below are only used by Layout, on the UI goroutine.
+	// size is the marker size in the last frame, zero before it was drawn
+	size image.Point
+	// iconOp is the op of iconImg, the last drawn marker.Icon
+	iconImg image.Image
+	iconOp  paint.ImageOp
+	// grab is where the pointer holds a dragged marker, relative to its
+	// top left corner
+	dragging bool
+	grab     f32.Point
+}
+
+func NewMarkerLayer() *MarkerLayer {
+	return &MarkerLayer{markers: make(map[string]*markerState)}
+}
+
+// Add adds a marker, replacing the marker with the same id
+func (l *MarkerLayer) Add(id string, m Marker) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if st, ok := l.markers[id]; ok {
+		st.marker = m
+		return
+	}
+	l.seq++
+	l.markers[id] = &markerState{marker: m, seq: l.seq}
+}
+
+// Update changes the marker id with fn and reports whether it exists
+func (l *MarkerLayer) Update(id string, fn func(m *Marker)) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st, ok := l.markers[id]
+	if ok {
+		fn(&st.marker)
+	}
+	return ok
+}
+
+// Remove removes the marker id and reports whether it existed
+func (l *MarkerLayer) Remove(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.markers[id]
+	delete(l.markers, id)
+	return ok
+}
+
+// Marker returns the marker id
+func (l *MarkerLayer) Marker(id string) (Marker, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st, ok := l.markers[id]
+	if !ok {
+		return Marker{}, false
+	}
+	return st.marker, true
+}
+
+// Len returns the number of markers
+func (l *MarkerLayer) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.markers)
+}
+
+// sorted returns the markers in drawing order
+func (l *MarkerLayer) sorted() []*markerState {
+	l.mu.Lock()
+	markers := make([]*markerState, 0, len(l.markers))
+	for _, st := range l.markers {
+		markers = append(markers, st)
+	}
+	l.mu.Unlock()
+	sort.Slice(markers, func(i, j int) bool {
+		a, b := markers[i], markers[j]
+		if a.marker.ZIndex != b.marker.ZIndex {
+			return a.marker.ZIndex < b.marker.ZIndex
+		}
+		return a.seq < b.seq
+	})
+	return markers
+}
+
+// Layout draws the markers that are in view
+func (l *MarkerLayer) Layout(gtx layout.Context, proj Projection) {
+	view := image.Rectangle{Max: proj.Size}
+	for _, st := range l.sorted() {
+		l.mu.Lock()
+		m := st.marker
+		l.mu.Unlock()
+
+		if m.Draggable {
+			l.processDrag(gtx, st, proj)
+			l.mu.Lock()
+			m = st.marker
+			l.mu.Unlock()
+		}
+		pos := proj.ToScreen(m.Position)
+		// Markers off screen in the last frame are not drawn, unless they
+		// are being dragged
+		if st.size != (image.Point{}) && !st.dragging && !markerRect(pos, m.Anchor, st.size).Overlaps(view) {
+			continue
+		}
+
+		macro := op.Record(gtx.Ops)
+		mgtx := gtx
+		mgtx.Constraints = layout.Constraints{Max: proj.Size}
+		dims := l.draw(mgtx, st, m)
+		call := macro.Stop()
+		st.size = dims.Size
+
+		r := markerRect(pos, m.Anchor, dims.Size)
+		if !r.Overlaps(view) && !st.dragging {
+			continue
+		}
+		offset := op.Offset(r.Min).Push(gtx.Ops)
+		if m.Draggable {
+			area := clip.Rect{Max: dims.Size}.Push(gtx.Ops)
+			event.Op(gtx.Ops, st)
+			pointer.CursorGrab.Add(gtx.Ops)
+			area.Pop()
+		}
+		call.Add(gtx.Ops)
+		offset.Pop()
+	}
+}
+
+// draw lays out the widget or icon of the marker
+func (l *MarkerLayer) draw(gtx layout.Context, st *markerState, m Marker) layout.Dimensions {
+	if m.Widget != nil {
+		return m.Widget(gtx)
+	}
+	if m.Icon == nil {
+		return layout.Dimensions{}
+	}
+	if st.iconImg != m.Icon {
+		// Reuse the op while the icon stays, so that its texture is not
+		// uploaded every frame
+		st.iconImg = m.Icon
+		st.iconOp = paint.NewImageOp(m.Icon)
+	}
+	st.iconOp.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	return layout.Dimensions{Size: m.Icon.Bounds().Size()}
+}
+
+// processDrag moves a draggable marker with the pointer
+func (l *MarkerLayer) processDrag(gtx layout.Context, st *markerState, proj Projection) {
+	for {
+		ev, ok := gtx.Event(pointer.Filter{
+			Target: st,
+			Kinds:  pointer.Press | pointer.Drag | pointer.Release | pointer.Cancel,
+		})
+		if !ok {
+			break
+		}
+		e, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+		if e.Kind == pointer.Press {
+			// Take the pointer from the map so that it does not pan
+			gtx.Execute(pointer.GrabCmd{Tag: st, ID: e.PointerID})
+		}
+		if end, pos := l.drag(st, e, proj); end != nil {
+			end(pos)
+		}
+	}
+}
+
+// drag applies a pointer event in the marker's coordinates to a dragged
+// marker. When the drag ends it returns the OnDragEnd to call with the new
+// position.
+func (l *MarkerLayer) drag(st *markerState, e pointer.Event, proj Projection) (func(tiles.LatLng), tiles.LatLng) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch e.Kind {
+	case pointer.Press:
+		st.dragging = true
+		st.grab = e.Position
+	case pointer.Drag:
+		if !st.dragging {
+			break
+		}
+		// The grabbed point follows the pointer
+		pos := proj.ToScreen(st.marker.Position)
+		st.marker.Position = proj.FromScreen(pos.Add(e.Position.Sub(st.grab)))
+	case pointer.Release:
+		if st.dragging {
+			st.dragging = false
+			return st.marker.OnDragEnd, st.marker.Position
+		}
+	case pointer.Cancel:
+		st.dragging = false
+	}
+	return nil, tiles.LatLng{}
+}
+
+// markerRect returns the screen rectangle of a marker of size whose anchor
+// is at pos
+func markerRect(pos, anchor f32.Point, size image.Point) image.Rectangle {
+	p := pos.Sub(f32.Pt(anchor.X*float32(size.X), anchor.Y*float32(size.Y))).Round()
+	return image.Rectangle{Min: p, Max: p.Add(size)}
+}
@@ -0,0 +1,107 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+func TestProjectionRoundTrip(t *testing.T) {
+	proj := Projection{Center: tiles.LatLng{Lat: 48.85, Lng: 2.35}, Zoom: 12.3, Bearing: 30, Size: image.Pt(800, 600)}
+	if got := proj.ToScreen(proj.Center); got != f32.Pt(400, 300) {
+		t.Errorf("center at %v, want the view center", got)
+	}
+	for _, pos := range []f32.Point{{}, {X: 800, Y: 600}, {X: 123, Y: 456}} {
+		got := proj.ToScreen(proj.FromScreen(pos))
+		if math.Abs(float64(got.X-pos.X)) > 1e-2 || math.Abs(float64(got.Y-pos.Y)) > 1e-2 {
+			t.Errorf("%v round trips to %v", pos, got)
+		}
+	}
+}
+
+// widgetCounter returns a widget of size that appends name to order when
+// it is laid out
+func widgetCounter(name string, size image.Point, order *[]string) layout.Widget {
+	return func(gtx layout.Context) layout.Dimensions {
+		*order = append(*order, name)
+		return layout.Dimensions{Size: size}
+	}
+}
+
+func TestMarkerLayerLayout(t *testing.T) {
+	proj := Projection{Center: tiles.LatLng{Lat: 10, Lng: 20}, Zoom: 8, Size: image.Pt(800, 600)}
+	far := proj.FromScreen(f32.Pt(-500, 300))
+	l := NewMarkerLayer()
+	var order []string
+	size := image.Pt(20, 30)
+	l.Add("top", Marker{Position: proj.Center, ZIndex: 1, Widget: widgetCounter("top", size, &order)})
+	l.Add("a", Marker{Position: proj.Center, Widget: widgetCounter("a", size, &order)})
+	l.Add("b", Marker{Position: proj.Center, Widget: widgetCounter("b", size, &order)})
+	l.Add("far", Marker{Position: far, Widget: widgetCounter("far", size, &order)})
+
+	gtx := layout.Context{Ops: new(op.Ops), Now: time.Now()}
+	l.Layout(gtx, proj)
+	if got, want := strings.Join(order, " "), "a b far top"; got != want {
+		t.Fatalf("drawn in order %q, want %q", got, want)
+	}
+
+	// Once its size is known, the marker off screen is not laid out
+	order = nil
+	l.Layout(gtx, proj)
+	for _, name := range order {
+		if name == "far" {
+			t.Error("off screen marker laid out")
+		}
+	}
+
+	if !l.Update("far", func(m *Marker) { m.Position = proj.Center }) || !l.Remove("a") || l.Remove("a") {
+		t.Fatal("update or remove failed")
+	}
+	order = nil
+	l.Layout(gtx, proj)
+	if len(order) != 3 {
+		t.Errorf("drew %v, want b, far and top", order)
+	}
+}
+
+func TestMarkerRectAnchor(t *testing.T) {
+	// A pin's bottom center sits on its position
+	r := markerRect(f32.Pt(100, 100), f32.Pt(0.5, 1), image.Pt(20, 30))
+	if want := image.Rect(90, 70, 110, 100); r != want {
+		t.Errorf("pin at %v, want %v", r, want)
+	}
+}
+
+func TestMarkerDrag(t *testing.T) {
+	proj := Projection{Center: tiles.LatLng{Lat: 10, Lng: 20}, Zoom: 8, Size: image.Pt(800, 600)}
+	l := NewMarkerLayer()
+	var ended tiles.LatLng
+	l.Add("m", Marker{Position: proj.Center, Draggable: true, OnDragEnd: func(ll tiles.LatLng) { ended = ll }})
+	st := l.markers["m"]
+
+	// Events are in the marker's coordinates, the marker follows the
+	// pointer from where it was grabbed
+	l.drag(st, pointer.Event{Kind: pointer.Press, Position: f32.Pt(5, 5)}, proj)
+	l.drag(st, pointer.Event{Kind: pointer.Drag, Position: f32.Pt(105, 55)}, proj)
+	end, pos := l.drag(st, pointer.Event{Kind: pointer.Release, Position: f32.Pt(105, 55)}, proj)
+	if end == nil {
+		t.Fatal("no OnDragEnd after release")
+	}
+	end(pos)
+
+	got := proj.ToScreen(ended)
+	if math.Abs(float64(got.X-500)) > 1e-2 || math.Abs(float64(got.Y-350)) > 1e-2 {
+		t.Errorf("marker dropped at %v, want (500,350)", got)
+	}
+	if m, _ := l.Marker("m"); m.Position != ended {
+		t.Errorf("marker at %v, OnDragEnd got %v", m.Position, ended)
+	}
+}
@@ -0,0 +1,159 @@
+package mapview
+
+import (
+	"math"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+// ScrollZoomOptions configures zooming with the mouse wheel and trackpad
+type ScrollZoomOptions struct {
+	// WheelStep is the zoom change of one mouse wheel notch, 0.5 when zero
+	WheelStep float64
+	// PixelsPerLevel is the trackpad scroll distance that zooms by one
+	// level, 100 when zero
+	PixelsPerLevel float64
+	// Smoothing is the time constant of the approach to the target zoom,
+	// 60ms when zero
+	Smoothing time.Duration
+	// Snap rounds the zoom to a whole level when a scroll gesture ends, so
+	// that tiles are drawn unscaled
+	Snap bool
+}
+
+func (o ScrollZoomOptions) withDefaults() ScrollZoomOptions {
+	if o.WheelStep <= 0 {
+		o.WheelStep = 0.5
+	}
+	if o.PixelsPerLevel <= 0 {
+		o.PixelsPerLevel = 100
+	}
+	if o.Smoothing <= 0 {
+		o.Smoothing = 60 * time.Millisecond
+	}
+	return o
+}
+
+const (
+	// scrollGestureEnd is the pause in scroll events that ends a gesture
+	scrollGestureEnd = 150 * time.Millisecond
+	// wheelNotch is the scroll distance of a wheel notch on Windows. X11
+	// reports 10 and Wayland 100, both counted as one notch.
+	wheelNotch = 120
+)
+
+// scrollZoom animates the zoom toward a target set by scroll events, with
+// the point under the cursor kept in place
+type scrollZoom struct {
+	opts   ScrollZoomOptions
+	active bool
+	target float64
+	// anchor is the cursor position and anchorLatLng the point under it
+	anchor       f32.Point
+	anchorLatLng tiles.LatLng
+	lastEvent    time.Time
+	lastFrame    time.Time
+	// pixels is set once the current gesture had a trackpad delta
+	pixels  bool
+	snapped bool
+}
+
+// isWheelDelta tells wheel notches from trackpad deltas. Gio reports both
+// in pixels, but notches come in whole multiples of 10 while trackpads
+// send arbitrary, mostly small, distances.
+func isWheelDelta(d float32) bool {
+	a := math.Abs(float64(d))
+	return a >= 10 && a == math.Trunc(a) && math.Mod(a, 10) == 0
+}
+
+// scroll handles a scroll event at zoom. The caller passes the point under
+// the cursor.
+func (s *scrollZoom) scroll(ev pointer.Event, zoom float64, under tiles.LatLng, now time.Time) {
+	d := ev.Scroll.Y
+	if d == 0 {
+		return
+	}
+	if !s.active || now.Sub(s.lastEvent) > scrollGestureEnd {
+		// A new gesture starts from the current zoom
+		s.target = zoom
+		s.pixels = false
+		s.lastFrame = now
+	}
+	s.active = true
+	s.snapped = false
+	s.lastEvent = now
+	s.anchor = ev.Position
+	s.anchorLatLng = under
+
+	if !s.pixels && isWheelDelta(d) {
+		notches := math.Max(1, math.Round(math.Abs(float64(d))/wheelNotch))
+		s.target -= math.Copysign(notches*s.opts.WheelStep, float64(d))
+	} else {
+		s.pixels = true
+		s.target -= float64(d) / s.opts.PixelsPerLevel
+	}
+}
+
+// step moves zoom toward the target for a frame at now. It returns the new
+// zoom and whether more frames are needed.
+func (s *scrollZoom) step(zoom float64, now time.Time) (float64, bool) {
+	if !s.active {
+		return zoom, false
+	}
+	if s.opts.Snap && !s.snapped && now.Sub(s.lastEvent) > scrollGestureEnd {
+		s.target = math.Round(s.target)
+		s.snapped = true
+	}
+	dt := now.Sub(s.lastFrame)
+	s.lastFrame = now
+	// Close the same fraction of the distance per unit of time, whatever
+	// the frame rate
+	k := 1 - math.Exp(-float64(dt)/float64(s.opts.Smoothing))
+	zoom += (s.target - zoom) * k
+
+	gestureOver := now.Sub(s.lastEvent) > scrollGestureEnd
+	if math.Abs(s.target-zoom) < 1e-3 {
+		zoom = s.target
+		if gestureOver || !s.opts.Snap {
+			s.active = false
+		}
+		// Keep the frames coming only to snap at the end of the gesture
+		return zoom, s.active
+	}
+	return zoom, true
+}
+
+// zoomAround sets zoom with the geographical point ll shown at the screen
+// position anchor
+func (mv *MapView) zoomAround(anchor f32.Point, ll tiles.LatLng, zoom float64) {
+	zoom = mv.clampZoom(zoom)
+	mv.setView(mv.centerAround(anchor, ll, zoom), zoom)
+}
+
+// centerAround returns the view center at zoom that shows ll at the screen
+// position anchor
+func (mv *MapView) centerAround(anchor f32.Point, ll tiles.LatLng, zoom float64) tiles.LatLng {
+	x, y := tiles.CalculateWorldCoordinates(ll, zoom)
+	d := mv.toMap(anchor.Sub(mv.screenCenter()))
+	x -= float64(d.X)
+	y -= float64(d.Y)
+	return tiles.WorldToLatLng(x, y, zoom)
+}
+
+// stepScrollZoom advances the scroll zoom animation to now and reports
+// whether it needs another frame
+func (mv *MapView) stepScrollZoom(now time.Time) bool {
+	s := &mv.scrollZoom
+	if !s.active {
+		return false
+	}
+	s.target = mv.clampZoom(s.target)
+	zoom, more := s.step(mv.zoom, now)
+	if zoom != mv.zoom {
+		mv.zoomAround(s.anchor, s.anchorLatLng, zoom)
+	}
+	return more
+}
@@ -0,0 +1,88 @@
+package mapview
+
+import (
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+)
+
+func TestIsWheelDelta(t *testing.T) {
+	for _, tc := range []struct {
+		d     float32
+		wheel bool
+	}{
+		{10, true},   // X11
+		{-100, true}, // Wayland
+		{120, true},  // Windows
+		{-240, true}, // Windows, two notches in one event
+		{3.5, false}, // smooth trackpad
+		{-7, false},  // Windows precision touchpad
+		{1, false},   // small trackpad step
+		{45.25, false},
+	} {
+		if got := isWheelDelta(tc.d); got != tc.wheel {
+			t.Errorf("isWheelDelta(%v) = %v, want %v", tc.d, got, tc.wheel)
+		}
+	}
+}
+
+func TestScrollZoomKeepsAnchor(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	mv.SetView(mv.center, 10)
+
+	start := time.Now()
+	cursor := f32.Pt(600, 150)
+	under := mv.screenToLatLng(cursor)
+	// Two notches toward the screen zoom in
+	for i := 0; i < 2; i++ {
+		ev := pointer.Event{Kind: pointer.Scroll, Position: cursor, Scroll: f32.Pt(0, -120)}
+		mv.scrollZoom.scroll(ev, mv.zoom, under, start)
+	}
+
+	now := start
+	for frame := 0; mv.stepScrollZoom(now); frame++ {
+		if frame > 1000 {
+			t.Fatal("scroll zoom never settles")
+		}
+		if mv.zoom < 10 || mv.zoom > 11 {
+			t.Fatalf("zoom %v outside 10..11", mv.zoom)
+		}
+		got := mv.screenToLatLng(cursor)
+		if math.Abs(got.Lat-under.Lat) > 1e-6 || math.Abs(got.Lng-under.Lng) > 1e-6 {
+			t.Fatalf("point under the cursor moved to %v, want %v", got, under)
+		}
+		now = now.Add(16 * time.Millisecond)
+	}
+	if mv.zoom != 11 {
+		t.Errorf("zoom %v after two notches, want 11", mv.zoom)
+	}
+}
+
+func TestScrollZoomSnap(t *testing.T) {
+	mv := newTestView(t)
+	mv.size = image.Pt(800, 600)
+	mv.SetView(mv.center, 10)
+	mv.scrollZoom.opts.Snap = true
+
+	start := time.Now()
+	// A trackpad gesture of 0.3 levels is rounded back once it ends
+	for i := 0; i < 10; i++ {
+		ev := pointer.Event{Kind: pointer.Scroll, Position: f32.Pt(400, 300), Scroll: f32.Pt(0, -3)}
+		mv.scrollZoom.scroll(ev, mv.zoom, mv.center, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	now := start
+	for frame := 0; mv.stepScrollZoom(now); frame++ {
+		if frame > 1000 {
+			t.Fatal("scroll zoom never settles")
+		}
+		now = now.Add(16 * time.Millisecond)
+	}
+	if mv.zoom != 10 {
+		t.Errorf("zoom %v after the gesture, want it snapped to 10", mv.zoom)
+	}
+}
@@ -0,0 +1,440 @@
+package mapview
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"sync"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+// Style is how a shape is drawn
+type Style struct {
+	// StrokeColor and StrokeWidth, in pixels, draw the outline. A zero
+	// width draws none.
+	StrokeColor color.NRGBA
+	StrokeWidth float32
+	// Dash alternates the lengths of dashes and gaps of the outline, in
+	// pixels. It is solid when empty.
+	Dash []float32
+	// FillColor fills polygons and circles
+	FillColor color.NRGBA
+	// Opacity scales the alpha of both colors, 1 when zero
+	Opacity float32
+}
+
+// Shape is a Polyline, Polygon or Circle
+type Shape interface {
+	style() Style
+}
+
+// Polyline is a line through Points
+type Polyline struct {
+	Points []tiles.LatLng
+	Style  Style
+}
+
+// Polygon is an area bounded by its first ring, with the other rings cut
+// out as holes. Rings are closed implicitly.
+type Polygon struct {
+	Rings [][]tiles.LatLng
+	Style Style
+}
+
+// Circle is the area within Radius meters of Center along the earth's
+// surface, which shows as an oval far from the equator
+type Circle struct {
+	Center tiles.LatLng
+	Radius float64
+	Style  Style
+}
+
+func (s Polyline) style() Style { return s.Style }
+func (s Polygon) style() Style  { return s.Style }
+func (s Circle) style() Style   { return s.Style }
+
+// circleSegments is the number of sides of the polygon drawn for a Circle
+const circleSegments = 128
+
+// strokeSteps is the number of scales per zoom level strokes are recorded
+// for, which keeps their width and dashes within about 2% of the style
+const strokeSteps = 16
+
+// vectorMinDistance drops vertices closer than it to the previous one, in
+// pixels at the zoom level the shape is projected for
+const vectorMinDistance = 0.5
+
+// VectorLayer is a Layer of shapes identified by string IDs, drawn in the
+// order they were added. Shapes are projected once per integer zoom level
+// and moved, scaled and turned for the view, so that large geometries stay
+// cheap to draw. Strokes are recorded again for fractional zoom levels so
+// that they keep their width. Its methods may be called from any goroutine.
+type VectorLayer struct {
+	mu     sync.Mutex
+	shapes map[string]*vectorShape
+	seq    uint64
+}
+
+type vectorShape struct {
+	shape Shape
+	seq   uint64
+	// The fields below are only used by Layout, on the UI goroutine.
+	// zoom is the zoom level the shape is projected for, -1 before it is,
+	// with origin the world coordinates its ops are relative to
+	zoom   int
+	origin [2]float64
+	// bounds are the projected bounds relative to origin
+	bounds bounds
+	ops    op.Ops
+	call   op.CallOp
+	// lines are the projected outlines, stroked by strokeCall for views
+	// strokeScale times as large as zoom, 0 before they are
+	lines       [][]f32.Point
+	strokeScale float32
+	strokeOps   op.Ops
+	strokeCall  op.CallOp
+}
+
+func NewVectorLayer() *VectorLayer {
+	return &VectorLayer{shapes: make(map[string]*vectorShape)}
+}
+
+// Add adds a shape, replacing the shape with the same id
+func (l *VectorLayer) Add(id string, s Shape) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seq := l.seq + 1
+	if old, ok := l.shapes[id]; ok {
+		seq = old.seq
+	} else {
+		l.seq = seq
+	}
+	l.shapes[id] = &vectorShape{shape: s, seq: seq, zoom: -1}
+}
+
+// Remove removes the shape id and reports whether it existed
+func (l *VectorLayer) Remove(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.shapes[id]
+	delete(l.shapes, id)
+	return ok
+}
+
+// Shape returns the shape id
+func (l *VectorLayer) Shape(id string) (Shape, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.shapes[id]
+	if !ok {
+		return nil, false
+	}
+	return s.shape, true
+}
+
+// Len returns the number of shapes
+func (l *VectorLayer) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.shapes)
+}
+
+// Layout draws the shapes that are in view
+func (l *VectorLayer) Layout(gtx layout.Context, proj Projection) {
+	l.mu.Lock()
+	shapes := make([]*vectorShape, 0, len(l.shapes))
+	for _, s := range l.shapes {
+		shapes = append(shapes, s)
+	}
+	l.mu.Unlock()
+	sort.Slice(shapes, func(i, j int) bool { return shapes[i].seq < shapes[j].seq })
+
+	zoom := int(math.Round(proj.Zoom))
+	for _, s := range shapes {
+		if s.zoom != zoom {
+			s.project(zoom)
+		}
+		tr := proj.transform(s.origin, zoom)
+		if !visible(tr, s.bounds, proj.Size) {
+			continue
+		}
+		scale := math.Round((proj.Zoom-float64(zoom))*strokeSteps) / strokeSteps
+		s.stroke(float32(math.Pow(2, scale)))
+		t := op.Affine(tr).Push(gtx.Ops)
+		s.call.Add(gtx.Ops)
+		s.strokeCall.Add(gtx.Ops)
+		t.Pop()
+	}
+}
+
+// transform returns the transformation from world coordinates at zoom,
+// relative to origin, to the view
+func (p Projection) transform(origin [2]float64, zoom int) f32.Affine2D {
+	scale := math.Pow(2, p.Zoom-float64(zoom))
+	cx, cy := tiles.CalculateWorldCoordinates(p.Center, p.Zoom)
+	// Subtract in float64, the world coordinates are too large for float32
+	d := f32.Pt(float32(origin[0]*scale-cx), float32(origin[1]*scale-cy))
+	c := p.screenCenter()
+	return f32.Affine2D{}.
+		Scale(f32.Point{}, f32.Pt(float32(scale), float32(scale))).
+		Offset(d.Add(c)).
+		Rotate(c, float32(-p.Bearing*math.Pi/180))
+}
+
+// visible reports whether the transformed bounds overlap the view
+func visible(tr f32.Affine2D, b bounds, size image.Point) bool {
+	r := emptyBounds()
+	for _, corner := range []f32.Point{b.Min, b.Max, {X: b.Min.X, Y: b.Max.Y}, {X: b.Max.X, Y: b.Min.Y}} {
+		r.add(tr.Transform(corner))
+	}
+	// Lines have empty bounds in one direction, so touching counts
+	return r.Max.X >= 0 && r.Min.X <= float32(size.X) && r.Max.Y >= 0 && r.Min.Y <= float32(size.Y)
+}
+
+// bounds is a rectangle that, unlike image.Rectangle, may be empty in
+// one direction and still contain points
+type bounds struct {
+	Min, Max f32.Point
+}
+
+// emptyBounds returns bounds that contain nothing until a point is added
+func emptyBounds() bounds {
+	return bounds{
+		Min: f32.Pt(math.MaxFloat32, math.MaxFloat32),
+		Max: f32.Pt(-math.MaxFloat32, -math.MaxFloat32),
+	}
+}
+
+// add grows b to contain p
+func (b *bounds) add(p f32.Point) {
+	b.Min = f32.Pt(min(b.Min.X, p.X), min(b.Min.Y, p.Y))
+	b.Max = f32.Pt(max(b.Max.X, p.X), max(b.Max.Y, p.Y))
+}
+
+// project records the ops of the shape for zoom
+func (s *vectorShape) project(zoom int) {
+	style := s.shape.style()
+	var rings [][]tiles.LatLng
+	closed := true
+	switch shape := s.shape.(type) {
+	case Polyline:
+		rings = [][]tiles.LatLng{shape.Points}
+		closed = false
+	case Polygon:
+		rings = shape.Rings
+	case Circle:
+		ring := make([]tiles.LatLng, circleSegments)
+		for i := range ring {
+			ring[i] = tiles.Destination(shape.Center, float64(i)*360/circleSegments, shape.Radius)
+		}
+		rings = [][]tiles.LatLng{ring}
+	}
+
+	s.zoom = zoom
+	s.origin = [2]float64{}
+	if len(rings) > 0 && len(rings[0]) > 0 {
+		s.origin[0], s.origin[1] = tiles.CalculateWorldCoordinates(rings[0][0], float64(zoom))
+	}
+	projected := make([][]f32.Point, 0, len(rings))
+	s.bounds = emptyBounds()
+	for _, ring := range rings {
+		pts := projectRing(ring, zoom, s.origin)
+		if len(pts) == 0 {
+			continue
+		}
+		for _, p := range pts {
+			s.bounds.add(p)
+		}
+		projected = append(projected, pts)
+	}
+	if len(projected) == 0 {
+		s.bounds = bounds{}
+	}
+	// Strokes reach beyond the vertices, by up to √2 times half their
+	// width between zoom levels
+	w := style.StrokeWidth / 2 * math.Sqrt2
+	s.bounds.Min = s.bounds.Min.Sub(f32.Pt(w, w))
+	s.bounds.Max = s.bounds.Max.Add(f32.Pt(w, w))
+
+	s.ops.Reset()
+	macro := op.Record(&s.ops)
+	o := opacity(style.Opacity)
+	if closed && style.FillColor.A > 0 && len(projected) > 0 {
+		paint.FillShape(&s.ops, fade(style.FillColor, o), clip.Outline{Path: fillPath(&s.ops, projected)}.Op())
+	}
+	s.call = macro.Stop()
+
+	s.lines = nil
+	s.strokeScale = 0
+	s.strokeOps.Reset()
+	s.strokeCall = op.CallOp{}
+	if style.StrokeWidth > 0 && style.StrokeColor.A > 0 {
+		for _, pts := range projected {
+			if closed && len(pts) > 0 {
+				pts = append(pts[:len(pts):len(pts)], pts[0])
+			}
+			s.lines = append(s.lines, pts)
+		}
+	}
+}
+
+// stroke records the outline of the shape for drawing scale times as
+// large as it is projected, with the width and dashes of the style
+func (s *vectorShape) stroke(scale float32) {
+	if len(s.lines) == 0 || s.strokeScale == scale {
+		return
+	}
+	style := s.shape.style()
+	s.strokeScale = scale
+	s.strokeOps.Reset()
+	macro := op.Record(&s.strokeOps)
+	lines := s.lines
+	if len(style.Dash) > 0 {
+		pattern := make([]float32, len(style.Dash))
+		for i, l := range style.Dash {
+			pattern[i] = l / scale
+		}
+		lines = nil
+		for _, pts := range s.lines {
+			lines = append(lines, dash(pts, pattern)...)
+		}
+	}
+	stroke := clip.Stroke{Path: linePath(&s.strokeOps, lines), Width: style.StrokeWidth / scale}
+	paint.FillShape(&s.strokeOps, fade(style.StrokeColor, opacity(style.Opacity)), stroke.Op())
+	s.strokeCall = macro.Stop()
+}
+
+// projectRing returns the world coordinates of ring at zoom relative to
+// origin, without vertices too close to show
+func projectRing(ring []tiles.LatLng, zoom int, origin [2]float64) []f32.Point {
+	pts := make([]f32.Point, 0, len(ring))
+	for i, ll := range ring {
+		x, y := tiles.CalculateWorldCoordinates(ll, float64(zoom))
+		p := f32.Pt(float32(x-origin[0]), float32(y-origin[1]))
+		if n := len(pts); n > 0 && i < len(ring)-1 {
+			d := p.Sub(pts[n-1])
+			if d.X*d.X+d.Y*d.Y < vectorMinDistance*vectorMinDistance {
+				continue
+			}
+		}
+		pts = append(pts, p)
+	}
+	return pts
+}
+
+// fillPath returns the outline of the rings, with the holes wound against
+// the outer ring so that they stay empty under the non-zero rule
+func fillPath(ops *op.Ops, rings [][]f32.Point) clip.PathSpec {
+	var p clip.Path
+	p.Begin(ops)
+	outer := signedArea(rings[0]) >= 0
+	for i, ring := range rings {
+		if len(ring) < 3 {
+			continue
+		}
+		reverse := i > 0 && (signedArea(ring) >= 0) == outer
+		for j := range ring {
+			pt := ring[j]
+			if reverse {
+				pt = ring[len(ring)-1-j]
+			}
+			if j == 0 {
+				p.MoveTo(pt)
+			} else {
+				p.LineTo(pt)
+			}
+		}
+		p.Close()
+	}
+	return p.End()
+}
+
+// linePath returns the path through each of lines
+func linePath(ops *op.Ops, lines [][]f32.Point) clip.PathSpec {
+	var p clip.Path
+	p.Begin(ops)
+	for _, line := range lines {
+		for j, pt := range line {
+			if j == 0 {
+				p.MoveTo(pt)
+			} else {
+				p.LineTo(pt)
+			}
+		}
+	}
+	return p.End()
+}
+
+// signedArea returns twice the signed area of ring, positive when it winds
+// clockwise on screen
+func signedArea(ring []f32.Point) float32 {
+	var a float32
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		a += p.X*q.Y - q.X*p.Y
+	}
+	return a
+}
+
+// dash splits the line through pts into the dashes of pattern
+func dash(pts []f32.Point, pattern []float32) [][]f32.Point {
+	var total float32
+	for _, l := range pattern {
+		if l < 0 {
+			return [][]f32.Point{pts}
+		}
+		total += l
+	}
+	if total <= 0 || len(pts) < 2 {
+		return [][]f32.Point{pts}
+	}
+	var dashes [][]f32.Point
+	var cur []f32.Point
+	i := 0             // pattern entry
+	left := pattern[0] // length left in the entry
+	on := true         // even entries are dashes
+	cur = append(cur, pts[0])
+	for k := 1; k < len(pts); k++ {
+		a, b := pts[k-1], pts[k]
+		seg := b.Sub(a)
+		length := float32(math.Hypot(float64(seg.X), float64(seg.Y)))
+		if length == 0 {
+			continue
+		}
+		var done float32
+		for length-done >= left {
+			done += left
+			p := a.Add(seg.Mul(done / length))
+			if on {
+				dashes = append(dashes, append(cur, p))
+				cur = nil
+			} else {
+				cur = []f32.Point{p}
+			}
+			on = !on
+			i = (i + 1) % len(pattern)
+			left = pattern[i]
+		}
+		left -= length - done
+		if on {
+			cur = append(cur, b)
+		}
+	}
+	if on && len(cur) > 1 {
+		dashes = append(dashes, cur)
+	}
+	return dashes
+}
+
+// fade scales the alpha of c by opacity
+func fade(c color.NRGBA, opacity float32) color.NRGBA {
+	c.A = uint8(float32(c.A)*min(opacity, 1) + 0.5)
+	return c
+}
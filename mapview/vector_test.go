@@ -0,0 +1,159 @@
+package mapview
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+func TestVectorLayerProjectsOncePerZoom(t *testing.T) {
+	proj := Projection{Center: tiles.LatLng{Lat: 10, Lng: 20}, Zoom: 8, Size: image.Pt(800, 600)}
+	l := NewVectorLayer()
+	l.Add("line", Polyline{
+		Points: []tiles.LatLng{{Lat: 10, Lng: 20}, {Lat: 10.1, Lng: 20.1}},
+		Style:  Style{StrokeColor: color.NRGBA{A: 255}, StrokeWidth: 2},
+	})
+	s := l.shapes["line"]
+	gtx := layout.Context{Ops: new(op.Ops)}
+
+	l.Layout(gtx, proj)
+	if s.zoom != 8 {
+		t.Fatalf("projected for zoom %v, want 8", s.zoom)
+	}
+	origin := s.origin
+	// Panning and fractional zoom reuse the projection
+	proj.Center = tiles.LatLng{Lat: 10.05, Lng: 20.05}
+	proj.Zoom = 8.3
+	proj.Bearing = 40
+	l.Layout(gtx, proj)
+	if s.zoom != 8 || s.origin != origin {
+		t.Errorf("reprojected for zoom %v", proj.Zoom)
+	}
+	proj.Zoom = 8.7
+	l.Layout(gtx, proj)
+	if s.zoom != 9 {
+		t.Errorf("projected for zoom %v, want 9", s.zoom)
+	}
+
+	// Replacing the shape projects it again
+	l.Add("line", Polyline{Points: []tiles.LatLng{{Lat: 10, Lng: 20}}})
+	if s := l.shapes["line"]; s.zoom != -1 || l.Len() != 1 {
+		t.Errorf("replaced shape at zoom %v with %v shapes", s.zoom, l.Len())
+	}
+}
+
+func TestVectorTransform(t *testing.T) {
+	proj := Projection{Center: tiles.LatLng{Lat: 48.85, Lng: 2.35}, Zoom: 12.4, Bearing: 30, Size: image.Pt(800, 600)}
+	ll := tiles.LatLng{Lat: 48.86, Lng: 2.37}
+	var origin [2]float64
+	origin[0], origin[1] = tiles.CalculateWorldCoordinates(tiles.LatLng{Lat: 48.84, Lng: 2.33}, 12)
+	x, y := tiles.CalculateWorldCoordinates(ll, 12)
+	got := proj.transform(origin, 12).Transform(f32.Pt(float32(x-origin[0]), float32(y-origin[1])))
+	want := proj.ToScreen(ll)
+	if math.Abs(float64(got.X-want.X)) > 1e-2 || math.Abs(float64(got.Y-want.Y)) > 1e-2 {
+		t.Errorf("vertex drawn at %v, want %v", got, want)
+	}
+}
+
+func TestVectorCulling(t *testing.T) {
+	proj := Projection{Center: tiles.LatLng{Lat: 10, Lng: 20}, Zoom: 8, Size: image.Pt(800, 600)}
+	l := NewVectorLayer()
+	// A horizontal line has bounds without height
+	l.Add("in", Polyline{Points: []tiles.LatLng{proj.FromScreen(f32.Pt(100, 300)), proj.FromScreen(f32.Pt(700, 300))}})
+	l.Add("out", Polyline{Points: []tiles.LatLng{proj.FromScreen(f32.Pt(-500, 300)), proj.FromScreen(f32.Pt(-100, 300))}})
+	l.Layout(layout.Context{Ops: new(op.Ops)}, proj)
+	for id, want := range map[string]bool{"in": true, "out": false} {
+		s := l.shapes[id]
+		if got := visible(proj.transform(s.origin, s.zoom), s.bounds, proj.Size); got != want {
+			t.Errorf("%s visible %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestCircleRadius(t *testing.T) {
+	c := Circle{Center: tiles.LatLng{Lat: 60, Lng: 10}, Radius: 5000}
+	for i := 0; i < circleSegments; i += 16 {
+		p := tiles.Destination(c.Center, float64(i)*360/circleSegments, c.Radius)
+		if d := tiles.Distance(c.Center, p); math.Abs(d-c.Radius) > 1e-6*c.Radius {
+			t.Errorf("vertex %v is %v m from the center, want %v", i, d, c.Radius)
+		}
+	}
+}
+
+func TestSignedArea(t *testing.T) {
+	// Clockwise on screen, where y points down
+	cw := []f32.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}}
+	if a := signedArea(cw); a != 200 {
+		t.Errorf("area %v, want 200", a)
+	}
+	ccw := []f32.Point{cw[3], cw[2], cw[1], cw[0]}
+	if a := signedArea(ccw); a != -200 {
+		t.Errorf("area %v, want -200", a)
+	}
+}
+
+func TestDash(t *testing.T) {
+	pts := []f32.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}}
+	dashes := dash(pts, []float32{4, 2})
+	// 0-4, 6-10, corner to 12 after it, then 14-18
+	want := [][]f32.Point{
+		{{X: 0, Y: 0}, {X: 4, Y: 0}},
+		{{X: 6, Y: 0}, {X: 10, Y: 0}},
+		{{X: 10, Y: 2}, {X: 10, Y: 6}},
+		{{X: 10, Y: 8}, {X: 10, Y: 10}},
+	}
+	if len(dashes) != len(want) {
+		t.Fatalf("got %v dashes %v, want %v", len(dashes), dashes, want)
+	}
+	for i := range want {
+		if len(dashes[i]) != len(want[i]) {
+			t.Errorf("dash %v is %v, want %v", i, dashes[i], want[i])
+			continue
+		}
+		for j := range want[i] {
+			if d := dashes[i][j].Sub(want[i][j]); math.Abs(float64(d.X))+math.Abs(float64(d.Y)) > 1e-4 {
+				t.Errorf("dash %v is %v, want %v", i, dashes[i], want[i])
+				break
+			}
+		}
+	}
+	if got := dash(pts, []float32{-1}); len(got) != 1 || len(got[0]) != len(pts) {
+		t.Errorf("invalid pattern gives %v, want the solid line", got)
+	}
+}
+
+func TestVectorStrokeWidthBetweenZooms(t *testing.T) {
+	proj := Projection{Center: tiles.LatLng{Lat: 10, Lng: 20}, Zoom: 8.5, Size: image.Pt(800, 600)}
+	l := NewVectorLayer()
+	l.Add("line", Polyline{
+		Points: []tiles.LatLng{{Lat: 10, Lng: 20}, {Lat: 10.1, Lng: 20.1}},
+		Style:  Style{StrokeColor: color.NRGBA{A: 255}, StrokeWidth: 4},
+	})
+	s := l.shapes["line"]
+	gtx := layout.Context{Ops: new(op.Ops)}
+
+	// Zoom 8.5 draws the shapes of zoom 9 at 0.71 times their size, so the
+	// stroke is recorded 1.41 times as wide
+	l.Layout(gtx, proj)
+	if s.zoom != 9 || math.Abs(float64(s.strokeScale)-math.Sqrt(0.5)) > 1e-6 {
+		t.Fatalf("stroke recorded for zoom %v at scale %v", s.zoom, s.strokeScale)
+	}
+	// Close zoom levels reuse the stroke
+	call := s.strokeCall
+	proj.Zoom = 8.51
+	l.Layout(gtx, proj)
+	if s.strokeCall != call {
+		t.Error("stroke recorded again for a zoom in the same step")
+	}
+	proj.Zoom = 9
+	l.Layout(gtx, proj)
+	if s.strokeScale != 1 {
+		t.Errorf("stroke scale %v at an integer zoom, want 1", s.strokeScale)
+	}
+}
@@ -1,15 +1,225 @@
 package tiles
 
-type CacheType int
+import (
+	"errors"
+	"image"
+	"sync"
 
-const (
-    CacheImage CacheType = iota
-    CacheImageOp
+	"gioui.org/op/paint"
 )
 
-type Cache interface {
-    Get(key string) (interface{}, bool)
-    Set(key string, value interface{})
-    Clear()
-    GetType() CacheType
+// ErrNotCached is returned by Cache.Load for misses without a loader
+var ErrNotCached = errors.New("not cached")
+
+// CacheOptions configures a Cache
+type CacheOptions[K comparable, V any] struct {
+	// Name labels the cache in metrics, caches without a name are not
+	// measured
+	Name string
+	// Policy decides which entries to evict, nil keeps everything
+	Policy EvictionPolicy[K]
+	// Size returns the cost of a value counted against the policy's budget,
+	// every value costs 1 when nil
+	Size func(V) int64
+	// Loader fills misses in Load
+	Loader func(K) (V, error)
+	// OnEvict is called for entries dropped by the policy, outside of the
+	// cache lock
+	OnEvict func(K, V)
+}
+
+// Cache is a concurrency safe map with pluggable eviction and an optional
+// loader for misses. Pinned keys are never evicted.
+type Cache[K comparable, V any] struct {
+	opts   CacheOptions[K, V]
+	mu     sync.Mutex
+	items  map[K]cacheEntry[V]
+	pinned map[K]bool
+	bytes  int64
+}
+
+type cacheEntry[V any] struct {
+	value V
+	size  int64
+}
+
+func NewCache[K comparable, V any](opts CacheOptions[K, V]) *Cache[K, V] {
+	return &Cache[K, V]{
+		opts:   opts,
+		items:  make(map[K]cacheEntry[V]),
+		pinned: make(map[K]bool),
+	}
+}
+
+// Get returns the cached value, counting a hit or miss for named caches
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	v, ok := c.lookup(key)
+	if c.opts.Name != "" {
+		if ok {
+			cacheHits.Inc(c.opts.Name)
+		} else {
+			cacheMisses.Inc(c.opts.Name)
+		}
+	}
+	return v, ok
+}
+
+// lookup is Get without the metrics, for callers that check the cache
+// every frame and count their own traffic
+func (c *Cache[K, V]) lookup(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if ok && c.opts.Policy != nil {
+		c.opts.Policy.Access(key)
+	}
+	return e.value, ok
+}
+
+func (c *Cache[K, V]) Set(key K, value V) {
+	size := int64(1)
+	if c.opts.Size != nil {
+		size = c.opts.Size(value)
+	}
+
+	c.mu.Lock()
+	if old, ok := c.items[key]; ok {
+		c.addBytes(-old.size)
+	}
+	c.items[key] = cacheEntry[V]{value: value, size: size}
+	c.addBytes(size)
+	var evicted map[K]V
+	if c.opts.Policy != nil {
+		c.opts.Policy.Insert(key, size)
+		evicted = c.evictLocked()
+	}
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+}
+
+// Load returns the cached value, or calls the loader and caches its result
+func (c *Cache[K, V]) Load(key K) (V, error) {
+	if v, ok := c.Get(key); ok {
+		return v, nil
+	}
+	if c.opts.Loader == nil {
+		var zero V
+		return zero, ErrNotCached
+	}
+	v, err := c.opts.Loader(key)
+	if err != nil {
+		return v, err
+	}
+	c.Set(key, v)
+	return v, nil
+}
+
+// Delete removes an entry without calling OnEvict
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	c.deleteLocked(key)
+	c.mu.Unlock()
+}
+
+// SetPinned replaces the set of keys exempt from eviction
+func (c *Cache[K, V]) SetPinned(keys []K) {
+	c.mu.Lock()
+	c.pinned = make(map[K]bool, len(keys))
+	for _, key := range keys {
+		c.pinned[key] = true
+	}
+	// Entries unpinned by this call may now be evicted
+	var evicted map[K]V
+	if c.opts.Policy != nil {
+		evicted = c.evictLocked()
+	}
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+}
+
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	for key := range c.items {
+		c.deleteLocked(key)
+	}
+	c.mu.Unlock()
+}
+
+// Len returns the number of entries
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Bytes returns the summed size of all entries
+func (c *Cache[K, V]) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+func (c *Cache[K, V]) deleteLocked(key K) {
+	e, ok := c.items[key]
+	if !ok {
+		return
+	}
+	delete(c.items, key)
+	c.addBytes(-e.size)
+	if c.opts.Policy != nil {
+		c.opts.Policy.Remove(key)
+	}
+}
+
+func (c *Cache[K, V]) addBytes(delta int64) {
+	c.bytes += delta
+	if c.opts.Name != "" {
+		cacheBytes.Add(float64(delta), c.opts.Name)
+	}
+}
+
+func (c *Cache[K, V]) evictLocked() map[K]V {
+	victims := c.opts.Policy.Victims(func(key K) bool { return c.pinned[key] })
+	if len(victims) == 0 {
+		return nil
+	}
+	evicted := make(map[K]V, len(victims))
+	for _, key := range victims {
+		evicted[key] = c.items[key].value
+		c.deleteLocked(key)
+	}
+	if c.opts.Name != "" {
+		cacheEvictions.Add(float64(len(victims)), c.opts.Name)
+	}
+	return evicted
+}
+
+func (c *Cache[K, V]) notifyEvicted(evicted map[K]V) {
+	if c.opts.OnEvict == nil {
+		return
+	}
+	for key, value := range evicted {
+		c.opts.OnEvict(key, value)
+	}
+}
+
+// ImageBytes estimates the memory held by a decoded image
+func ImageBytes(img image.Image) int64 {
+	b := img.Bounds()
+	bpp := int64(4)
+	switch img.(type) {
+	case *image.Gray, *image.Alpha, *image.Paletted:
+		bpp = 1
+	case *image.RGBA64, *image.NRGBA64:
+		bpp = 8
+	}
+	return int64(b.Dx()) * int64(b.Dy()) * bpp
+}
+
+// ImageOpBytes estimates the texture memory of an ImageOp
+func ImageOpBytes(op paint.ImageOp) int64 {
+	size := op.Size()
+	return int64(size.X) * int64(size.Y) * 4
 }
@@ -0,0 +1,91 @@
+package tiles
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func newTestCache(tiles int) *Cache[string, image.Image] {
+	return NewCache(CacheOptions[string, image.Image]{
+		Policy: NewLRUPolicy[string](int64(tiles) * 256 * 256 * 4),
+		Size:   ImageBytes,
+	})
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	tile := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	c := newTestCache(3)
+
+	c.Set("a", tile)
+	c.Set("b", tile)
+	c.Set("c", tile)
+	c.Get("a") // b is now the least recently used
+	c.Set("d", tile)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+}
+
+func TestCacheKeepsPinned(t *testing.T) {
+	tile := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	c := newTestCache(2)
+
+	c.SetPinned([]string{"a", "b"})
+	c.Set("a", tile)
+	c.Set("b", tile)
+	c.Set("c", tile)
+	for _, key := range []string{"a", "b"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("pinned %s was evicted", key)
+		}
+	}
+	if _, ok := c.Get("c"); ok {
+		t.Error("c should have been evicted instead of the pinned tiles")
+	}
+
+	// Unpinning brings the cache back within its budget
+	c.SetPinned(nil)
+	if c.Len() != 2 {
+		t.Errorf("got %d entries after unpinning, want 2", c.Len())
+	}
+}
+
+func TestCacheLoaderAndOnEvict(t *testing.T) {
+	var evicted []int
+	loads := 0
+	c := NewCache(CacheOptions[int, int]{
+		Policy: NewLRUPolicy[int](2),
+		Loader: func(k int) (int, error) {
+			loads++
+			if k < 0 {
+				return 0, errors.New("negative")
+			}
+			return k * k, nil
+		},
+		OnEvict: func(k, _ int) { evicted = append(evicted, k) },
+	})
+
+	if v, err := c.Load(3); err != nil || v != 9 {
+		t.Fatalf("Load(3) = %d, %v", v, err)
+	}
+	c.Load(3)
+	if loads != 1 {
+		t.Errorf("got %d loads, want 1", loads)
+	}
+	if _, err := c.Load(-1); err == nil {
+		t.Error("expected the loader error")
+	}
+
+	c.Load(4)
+	c.Load(5)
+	if len(evicted) != 1 || evicted[0] != 3 {
+		t.Errorf("evicted %v, want [3]", evicted)
+	}
+}
@@ -1,6 +1,7 @@
 package tiles
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"sync"
@@ -9,83 +10,109 @@ import (
 type CombinedTileProvider struct {
 	primary    TileProvider
 	fallback   TileProvider
-	loading    map[string]bool
+	loading    map[Tile]bool
 	loadingMu  sync.RWMutex
 	onLoadFunc func()
-	cache      map[string]image.Image
-	cacheMu    sync.RWMutex
+	onLoadMu   sync.RWMutex
+	cache      *Cache[Tile, image.Image]
 }
 
 func NewCombinedTileProvider(primary, fallback TileProvider) *CombinedTileProvider {
 	return &CombinedTileProvider{
 		primary:  primary,
 		fallback: fallback,
-		loading:  make(map[string]bool),
-		cache:    make(map[string]image.Image),
+		loading:  make(map[Tile]bool),
+		cache: NewCache(CacheOptions[Tile, image.Image]{
+			Policy: NewLRUPolicy[Tile](DefaultCacheBudget),
+			Size:   ImageBytes,
+		}),
 	}
 }
 
+// SetOnLoadCallback sets a function called when a tile loaded in the
+// background replaces its fallback. It may be called while tiles load.
 func (p *CombinedTileProvider) SetOnLoadCallback(callback func()) {
+	p.onLoadMu.Lock()
 	p.onLoadFunc = callback
+	p.onLoadMu.Unlock()
 }
 
 func (p *CombinedTileProvider) GetTile(tile Tile) (image.Image, error) {
-    key := GetTileKey(tile)
-
-    // Check if we already have the OSM tile cached
-    p.cacheMu.RLock()
-    if cachedImg, exists := p.cache[key]; exists {
-        p.cacheMu.RUnlock()
-        return cachedImg, nil
-    }
-    p.cacheMu.RUnlock()
-
-    // Try to get OSM tile without blocking
-    primaryImg, err := p.primary.GetTile(tile)
-    if err == nil {
-        // Cache the successfully loaded OSM tile
-        p.cacheMu.Lock()
-        p.cache[key] = primaryImg
-        p.cacheMu.Unlock()
-        return primaryImg, nil
-    }
-
-    // Get local tile immediately
-    fallbackImg, err := p.fallback.GetTile(tile)
-    if err != nil {
-        return nil, fmt.Errorf("both primary and fallback providers failed: %v", err)
-    }
-
-    // Check if we're already loading this OSM tile
-    p.loadingMu.RLock()
-    isLoading := p.loading[key]
-    p.loadingMu.RUnlock()
-
-    if !isLoading {
-        // Start loading the OSM tile in background
-        p.loadingMu.Lock()
-        p.loading[key] = true
-        p.loadingMu.Unlock()
-
-        go func() {
-            // Load OSM tile asynchronously
-            if img, err := p.primary.GetTile(tile); err == nil {
-                p.cacheMu.Lock()
-                p.cache[key] = img
-                p.cacheMu.Unlock()
-
-                // Notify that new tile is available
-                if p.onLoadFunc != nil {
-                    p.onLoadFunc()
-                }
-            }
-
-            p.loadingMu.Lock()
-            delete(p.loading, key)
-            p.loadingMu.Unlock()
-        }()
-    }
-
-    // Return local tile while OSM loads
-    return fallbackImg, nil
+	// Check if we already have the OSM tile cached
+	if cachedImg, exists := p.cache.Get(tile); exists {
+		return cachedImg, nil
+	}
+
+	// Try to get OSM tile without blocking
+	primaryImg, err := p.primary.GetTile(tile)
+	if err == nil {
+		// Cache the successfully loaded OSM tile
+		p.cache.Set(tile, primaryImg)
+		return primaryImg, nil
+	}
+
+	// Get local tile immediately
+	fallbackImg, err := p.fallback.GetTile(tile)
+	if err != nil {
+		return nil, fmt.Errorf("both primary and fallback providers failed: %v", err)
+	}
+
+	// Check if we're already loading this OSM tile
+	p.loadingMu.RLock()
+	isLoading := p.loading[tile]
+	p.loadingMu.RUnlock()
+
+	if !isLoading {
+		// Start loading the OSM tile in background
+		p.loadingMu.Lock()
+		p.loading[tile] = true
+		p.loadingMu.Unlock()
+
+		go func() {
+			// Load OSM tile asynchronously
+			if img, err := p.primary.GetTile(tile); err == nil {
+				p.cache.Set(tile, img)
+
+				// Notify that new tile is available
+				p.onLoadMu.RLock()
+				onLoad := p.onLoadFunc
+				p.onLoadMu.RUnlock()
+				if onLoad != nil {
+					onLoad()
+				}
+			}
+
+			p.loadingMu.Lock()
+			delete(p.loading, tile)
+			p.loadingMu.Unlock()
+		}()
+	}
+
+	// Return local tile while OSM loads
+	return fallbackImg, nil
+}
+
+// GetTileContext loads a tile from the primary provider only, without the
+// fallback, the cache and the background retry of GetTile. It suits callers
+// that cache and show placeholders themselves, such as TileManager.
+func (p *CombinedTileProvider) GetTileContext(ctx context.Context, tile Tile) (image.Image, error) {
+	return getTile(ctx, p.primary, tile)
+}
+
+// Host returns the primary provider's host, if it has one
+func (p *CombinedTileProvider) Host() string {
+	if hp, ok := p.primary.(HostTileProvider); ok {
+		return hp.Host()
+	}
+	return ""
+}
+
+// GetTileData returns the primary provider's encoded tile, or
+// ErrNoTileData when the primary provider is not a TileDataProvider
+func (p *CombinedTileProvider) GetTileData(tile Tile) ([]byte, error) {
+	return p.GetTileDataContext(context.Background(), tile)
+}
+
+func (p *CombinedTileProvider) GetTileDataContext(ctx context.Context, tile Tile) ([]byte, error) {
+	return getTileData(ctx, p.primary, tile)
 }
@@ -0,0 +1,99 @@
+package tiles
+
+import (
+	"errors"
+	"image"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olablt/gio-tiles/tiles/tiletest"
+)
+
+func TestCombinedTileProviderCachesPrimary(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	p := NewCombinedTileProvider(
+		NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+		NewLocalTileProvider(),
+	)
+
+	tile := Tile{X: 2, Y: 1, Zoom: 3}
+	for i := 0; i < 3; i++ {
+		if _, err := p.GetTile(tile); err != nil {
+			t.Fatalf("GetTile: %v", err)
+		}
+	}
+	if n := srv.Requests(3, 2, 1); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestCombinedTileProviderFallback(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	srv.SetDefault(tiletest.Behavior{StatusCode: http.StatusServiceUnavailable})
+	local := NewLocalTileProvider()
+	p := NewCombinedTileProvider(
+		NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+		local,
+	)
+
+	tile := Tile{X: 2, Y: 1, Zoom: 3}
+	img, err := p.GetTile(tile)
+	if err != nil {
+		t.Fatalf("GetTile: %v", err)
+	}
+	want, _ := local.GetTile(tile)
+	if img != want {
+		t.Error("expected the fallback tile while the primary fails")
+	}
+}
+
+// failOnceProvider fails the first request of every tile, so that
+// CombinedTileProvider loads it in the background
+type failOnceProvider struct {
+	mu   sync.Mutex
+	seen map[Tile]bool
+}
+
+func (p *failOnceProvider) GetTile(tile Tile) (image.Image, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.seen[tile] {
+		p.seen[tile] = true
+		return nil, errors.New("not yet")
+	}
+	return image.NewRGBA(image.Rect(0, 0, 1, 1)), nil
+}
+
+func TestCombinedTileProviderSetOnLoadCallbackWhileLoading(t *testing.T) {
+	p := NewCombinedTileProvider(&failOnceProvider{seen: map[Tile]bool{}}, NewLocalTileProvider())
+	loaded := make(chan struct{}, 100)
+	onLoad := func() { loaded <- struct{}{} }
+	p.SetOnLoadCallback(onLoad)
+
+	// Run with -race: the background loads read the callback while it is
+	// replaced
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			p.SetOnLoadCallback(onLoad)
+		}
+		close(done)
+	}()
+	for x := 0; x < 5; x++ {
+		if _, err := p.GetTile(Tile{X: x, Zoom: 3}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	for i := 0; i < 5; i++ {
+		select {
+		case <-loaded:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of 5 tiles loaded", i)
+		}
+	}
+}
@@ -38,6 +38,18 @@ func TileToLatLng(tile Tile) LatLng {
 	return LatLng{Lat: lat_deg, Lng: lon_deg}
 }
 
+// TileBounds returns the north-west and south-east corners of a tile
+func TileBounds(tile Tile) (nw, se LatLng) {
+	nw = TileToLatLng(tile)
+	se = TileToLatLng(Tile{X: tile.X + 1, Y: tile.Y + 1, Zoom: tile.Zoom})
+	return nw, se
+}
+
+// TileCenter returns the geographical center of a tile
+func TileCenter(tile Tile) LatLng {
+	return WorldToLatLng((float64(tile.X)+0.5)*TileSize, (float64(tile.Y)+0.5)*TileSize, float64(tile.Zoom))
+}
+
 // CalculateWorldCoordinates converts geographical coordinates to world pixel coordinates at given zoom level
 func CalculateWorldCoordinates(ll LatLng, zoom float64) (float64, float64) {
 	n := math.Pow(2, zoom)
@@ -95,3 +107,23 @@ func CalculateVisibleTiles(center LatLng, zoom int, screenSize image.Point) []Ti
 	}
 	return visibleTiles
 }
+
+// Distance returns the great-circle distance between a and b in meters
+func Distance(a, b LatLng) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// Destination returns the point distance meters from ll along the great
+// circle leaving it at bearing degrees clockwise from north
+func Destination(ll LatLng, bearing, distance float64) LatLng {
+	lat1, lng1 := ll.Lat*math.Pi/180, ll.Lng*math.Pi/180
+	theta := bearing * math.Pi / 180
+	delta := distance / earthRadius
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(delta) + math.Cos(lat1)*math.Sin(delta)*math.Cos(theta))
+	lng2 := lng1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(lat1), math.Cos(delta)-math.Sin(lat1)*math.Sin(lat2))
+	return LatLng{Lat: lat2 * 180 / math.Pi, Lng: math.Mod(lng2*180/math.Pi+540, 360) - 180}
+}
@@ -0,0 +1,23 @@
+package tiles
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDestinationDistance(t *testing.T) {
+	london := LatLng{Lat: 51.507222, Lng: -0.1275}
+	paris := LatLng{Lat: 48.8566, Lng: 2.3522}
+	if d := Distance(london, paris); math.Abs(d-344e3) > 2e3 {
+		t.Errorf("London to Paris is %.0fm, want about 344km", d)
+	}
+	for _, bearing := range []float64{0, 45, 135, 270} {
+		to := Destination(london, bearing, 10e3)
+		if d := Distance(london, to); math.Abs(d-10e3) > 1e-3 {
+			t.Errorf("bearing %v: destination %.3fm away, want 10km", bearing, d)
+		}
+	}
+	if to := Destination(london, 90, 10e3); to.Lng <= london.Lng || math.Abs(to.Lat-london.Lat) > 0.01 {
+		t.Errorf("10km east of London is %v", to)
+	}
+}
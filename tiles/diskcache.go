@@ -0,0 +1,167 @@
+package tiles
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// ErrCorrupt is returned for cached files failing their checksum
+var ErrCorrupt = errors.New("corrupt cache file")
+
+// diskMagic starts every cache file, followed by a CRC-32 of the payload
+var diskMagic = []byte("GTC1")
+
+const diskHeaderSize = 8
+
+// DiskCache stores encoded tiles below a directory as z/x/y.tile files.
+// Writes are queued and performed by a background goroutine, so Store never
+// blocks on the file system. Every file carries a checksum, and corrupted
+// files are removed when read.
+type DiskCache struct {
+	dir   string
+	queue chan diskWrite
+	wg    sync.WaitGroup
+	// closed is set by Close, after which the queue takes no writes
+	closedMu sync.RWMutex
+	closed   bool
+}
+
+type diskWrite struct {
+	tile  Tile
+	data  []byte
+	flush chan struct{}
+}
+
+// NewDiskCache creates dir if needed and starts the write-behind goroutine
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{
+		dir:   dir,
+		queue: make(chan diskWrite, 256),
+	}
+	c.wg.Add(1)
+	go c.writer()
+	return c, nil
+}
+
+func (c *DiskCache) path(tile Tile) string {
+	return filepath.Join(c.dir, strconv.Itoa(tile.Zoom), strconv.Itoa(tile.X), strconv.Itoa(tile.Y)+".tile")
+}
+
+// Get returns the encoded tile, os.ErrNotExist on a miss and ErrCorrupt
+// when the file fails its checksum
+func (c *DiskCache) Get(tile Tile) ([]byte, error) {
+	path := c.path(tile)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < diskHeaderSize || string(raw[:4]) != string(diskMagic) ||
+		binary.BigEndian.Uint32(raw[4:8]) != crc32.ChecksumIEEE(raw[diskHeaderSize:]) {
+		os.Remove(path)
+		return nil, ErrCorrupt
+	}
+	return raw[diskHeaderSize:], nil
+}
+
+// Store queues the encoded tile for writing. The write is dropped when the
+// queue is full or the cache closed, the tile is then simply fetched again
+// next time.
+func (c *DiskCache) Store(tile Tile, data []byte) {
+	c.closedMu.RLock()
+	defer c.closedMu.RUnlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queue <- diskWrite{tile: tile, data: data}:
+	default:
+		log.Printf("DiskCache: write queue full, dropping tile %v", tile)
+	}
+}
+
+// Put writes the encoded tile synchronously
+func (c *DiskCache) Put(tile Tile, data []byte) error {
+	path := c.path(tile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	raw := make([]byte, diskHeaderSize+len(data))
+	copy(raw, diskMagic)
+	binary.BigEndian.PutUint32(raw[4:8], crc32.ChecksumIEEE(data))
+	copy(raw[diskHeaderSize:], data)
+
+	// Write to a temporary file first so readers never see a partial tile
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tile-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Delete removes the tile, for entries that pass their checksum but are
+// unusable
+func (c *DiskCache) Delete(tile Tile) error {
+	err := os.Remove(c.path(tile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Flush blocks until all queued writes are on disk. It returns at once
+// after Close, which writes them itself.
+func (c *DiskCache) Flush() {
+	c.closedMu.RLock()
+	if c.closed {
+		c.closedMu.RUnlock()
+		return
+	}
+	done := make(chan struct{})
+	c.queue <- diskWrite{flush: done}
+	c.closedMu.RUnlock()
+	<-done
+}
+
+// Close writes the queued tiles and stops the writer goroutine
+func (c *DiskCache) Close() error {
+	c.closedMu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.closedMu.Unlock()
+	c.wg.Wait()
+	return nil
+}
+
+func (c *DiskCache) writer() {
+	defer c.wg.Done()
+	for w := range c.queue {
+		if w.flush != nil {
+			close(w.flush)
+			continue
+		}
+		if err := c.Put(w.tile, w.data); err != nil {
+			log.Printf("DiskCache: error writing tile %v: %v", w.tile, err)
+		}
+	}
+}
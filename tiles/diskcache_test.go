@@ -0,0 +1,138 @@
+package tiles
+
+import (
+	"errors"
+	"image/color"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/olablt/gio-tiles/tiles/tiletest"
+)
+
+func TestDiskCacheRoundTrip(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tile := Tile{X: 1, Y: 2, Zoom: 3}
+	if _, err := c.Get(tile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v for a missing tile, want os.ErrNotExist", err)
+	}
+
+	c.Store(tile, []byte("tile data"))
+	c.Flush()
+	data, err := c.Get(tile)
+	if err != nil || string(data) != "tile data" {
+		t.Fatalf("Get = %q, %v", data, err)
+	}
+}
+
+func TestDiskCacheDetectsCorruption(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tile := Tile{X: 1, Y: 2, Zoom: 3}
+	if err := c.Put(tile, []byte("tile data")); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(c.path(tile))
+	raw[len(raw)-1] ^= 0xff
+	os.WriteFile(c.path(tile), raw, 0o644)
+
+	if _, err := c.Get(tile); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("got %v, want ErrCorrupt", err)
+	}
+	if _, err := os.Stat(c.path(tile)); !os.IsNotExist(err) {
+		t.Error("corrupt file was not removed")
+	}
+}
+
+func TestTileManagerColdStartFromDisk(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	disk, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+
+	tile := Tile{X: 3, Y: 2, Zoom: 4}
+	load := func() {
+		tm := NewTileManagerWithOptions(
+			NewCombinedTileProvider(
+				NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+				NewLocalTileProvider(),
+			),
+			TileManagerOptions{DiskCache: disk},
+		)
+		loaded := make(chan struct{}, 1)
+		tm.SetOnLoadCallback(func() { loaded <- struct{}{} })
+		tm.GetTile(tile)
+		select {
+		case <-loaded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("tile was never loaded")
+		}
+	}
+
+	load()
+	disk.Flush()
+	// A fresh manager has an empty memory tier and must use the disk
+	load()
+	if n := srv.Requests(4, 3, 2); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestDiskCacheAfterClose(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	// A load finishing during shutdown must not panic
+	tile := Tile{X: 1, Y: 2, Zoom: 3}
+	c.Store(tile, []byte("tile data"))
+	c.Flush()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(tile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v for a tile stored after Close, want os.ErrNotExist", err)
+	}
+}
+
+func TestTileManagerDeletesUndecodableDiskTile(t *testing.T) {
+	disk, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+
+	// The checksum is right, the image is not
+	tile := Tile{X: 3, Y: 2, Zoom: 4}
+	if err := disk.Put(tile, []byte("not an image")); err != nil {
+		t.Fatal(err)
+	}
+	// The provider serves images only, so nothing replaces the file
+	upstream := &countingProvider{c: color.RGBA{A: 255}}
+	tm := NewTileManagerWithOptions(upstream, TileManagerOptions{DiskCache: disk})
+	defer tm.Close()
+
+	if _, err := tm.load(tm.Context(), tile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := disk.Get(tile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v for the undecodable tile, want os.ErrNotExist", err)
+	}
+	if upstream.calls != 1 {
+		t.Errorf("got %d upstream calls, want 1", upstream.calls)
+	}
+}
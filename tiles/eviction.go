@@ -0,0 +1,85 @@
+package tiles
+
+import "container/list"
+
+// DefaultCacheBudget is the memory budget of tile caches created without one
+const DefaultCacheBudget = 256 << 20
+
+// EvictionPolicy decides which entries a Cache drops. Cache serializes
+// all calls.
+type EvictionPolicy[K comparable] interface {
+	// Insert records a new or replaced entry of the given size
+	Insert(key K, size int64)
+	// Access records a cache hit
+	Access(key K)
+	// Remove forgets an entry dropped by the cache
+	Remove(key K)
+	// Victims returns the entries to drop to get back within the policy's
+	// limits, skipping pinned ones
+	Victims(pinned func(K) bool) []K
+}
+
+// LRUPolicy evicts least recently used entries once their summed size
+// exceeds a budget. It may stay over budget when everything is pinned.
+type LRUPolicy[K comparable] struct {
+	budget int64
+	used   int64
+	order  *list.List // front is most recently used
+	items  map[K]*list.Element
+}
+
+type lruEntry[K comparable] struct {
+	key  K
+	size int64
+}
+
+func NewLRUPolicy[K comparable](budget int64) *LRUPolicy[K] {
+	if budget <= 0 {
+		budget = DefaultCacheBudget
+	}
+	return &LRUPolicy[K]{
+		budget: budget,
+		order:  list.New(),
+		items:  make(map[K]*list.Element),
+	}
+}
+
+func (p *LRUPolicy[K]) Insert(key K, size int64) {
+	if e, ok := p.items[key]; ok {
+		entry := e.Value.(*lruEntry[K])
+		p.used += size - entry.size
+		entry.size = size
+		p.order.MoveToFront(e)
+		return
+	}
+	p.items[key] = p.order.PushFront(&lruEntry[K]{key: key, size: size})
+	p.used += size
+}
+
+func (p *LRUPolicy[K]) Access(key K) {
+	if e, ok := p.items[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *LRUPolicy[K]) Remove(key K) {
+	if e, ok := p.items[key]; ok {
+		p.order.Remove(e)
+		delete(p.items, key)
+		p.used -= e.Value.(*lruEntry[K]).size
+	}
+}
+
+func (p *LRUPolicy[K]) Victims(pinned func(K) bool) []K {
+	var victims []K
+	over := p.used - p.budget
+	for e := p.order.Back(); e != nil && over > 0; e = e.Prev() {
+		entry := e.Value.(*lruEntry[K])
+		if pinned(entry.key) {
+			continue
+		}
+		victims = append(victims, entry.key)
+		over -= entry.size
+	}
+	return victims
+}
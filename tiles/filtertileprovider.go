@@ -0,0 +1,281 @@
+package tiles
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Filter transforms tile colors pixel by pixel
+type Filter interface {
+	// Name identifies the filter and its parameters, it is part of the
+	// cache key of filtered tiles
+	Name() string
+	// Map transforms a single non-premultiplied color
+	Map(c color.NRGBA) color.NRGBA
+}
+
+// FilterTileProvider applies a Filter to the tiles of an upstream provider.
+// Filtered tiles are cached per filter, so switching filters back and forth
+// does not redo the work. Wrap the network provider rather than a
+// CombinedTileProvider, whose placeholder tiles would be cached too.
+type FilterTileProvider struct {
+	upstream TileProvider
+	filter   Filter
+	filterMu sync.RWMutex
+	cache    *Cache[filterKey, image.Image]
+}
+
+type filterKey struct {
+	filter string
+	tile   Tile
+}
+
+func NewFilterTileProvider(upstream TileProvider, filter Filter) *FilterTileProvider {
+	return &FilterTileProvider{
+		upstream: upstream,
+		filter:   filter,
+		cache: NewCache(CacheOptions[filterKey, image.Image]{
+			Policy: NewLRUPolicy[filterKey](DefaultCacheBudget),
+			Size:   ImageBytes,
+		}),
+	}
+}
+
+// SetFilter switches the filter applied to subsequent tiles, nil disables
+// filtering
+func (p *FilterTileProvider) SetFilter(filter Filter) {
+	p.filterMu.Lock()
+	p.filter = filter
+	p.filterMu.Unlock()
+}
+
+func (p *FilterTileProvider) Filter() Filter {
+	p.filterMu.RLock()
+	defer p.filterMu.RUnlock()
+	return p.filter
+}
+
+func (p *FilterTileProvider) GetTile(tile Tile) (image.Image, error) {
+	return p.GetTileContext(context.Background(), tile)
+}
+
+// GetTileContext passes ctx on to the upstream provider
+func (p *FilterTileProvider) GetTileContext(ctx context.Context, tile Tile) (image.Image, error) {
+	filter := p.Filter()
+	if filter == nil {
+		return getTile(ctx, p.upstream, tile)
+	}
+
+	key := filterKey{filter: filter.Name(), tile: tile}
+	if cached, exists := p.cache.Get(key); exists {
+		return cached, nil
+	}
+
+	img, err := getTile(ctx, p.upstream, tile)
+	if err != nil {
+		return nil, err
+	}
+	filtered := ApplyFilter(img, filter)
+
+	p.cache.Set(key, filtered)
+	return filtered, nil
+}
+
+// Host returns the upstream provider's host, if it has one
+func (p *FilterTileProvider) Host() string {
+	if hp, ok := p.upstream.(HostTileProvider); ok {
+		return hp.Host()
+	}
+	return ""
+}
+
+// ClearCache drops the filtered tiles of all filters
+func (p *FilterTileProvider) ClearCache() {
+	p.cache.Clear()
+}
+
+// ApplyFilter returns a filtered copy of img
+func ApplyFilter(img image.Image, filter Filter) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dst := image.NewRGBA(src.Bounds())
+	for i := 0; i < len(src.Pix); i += 4 {
+		c := filter.Map(color.NRGBA{src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3]})
+		// Premultiply for the RGBA destination
+		a := uint32(c.A)
+		dst.Pix[i+0] = uint8(uint32(c.R) * a / 255)
+		dst.Pix[i+1] = uint8(uint32(c.G) * a / 255)
+		dst.Pix[i+2] = uint8(uint32(c.B) * a / 255)
+		dst.Pix[i+3] = c.A
+	}
+	return dst
+}
+
+// colorMatrix is a 3x3 RGB matrix filter applied to the 0-255 channel
+// values. It has no offset term, which would need the channels scaled to
+// 0-1 first.
+type colorMatrix struct {
+	name string
+	m    [9]float64
+}
+
+func (f colorMatrix) Name() string { return f.name }
+
+func (f colorMatrix) Map(c color.NRGBA) color.NRGBA {
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	return color.NRGBA{
+		R: clamp8(f.m[0]*r + f.m[1]*g + f.m[2]*b),
+		G: clamp8(f.m[3]*r + f.m[4]*g + f.m[5]*b),
+		B: clamp8(f.m[6]*r + f.m[7]*g + f.m[8]*b),
+		A: c.A,
+	}
+}
+
+// Grayscale converts colors to their luminance
+func Grayscale() Filter {
+	return colorMatrix{name: "grayscale", m: [9]float64{
+		0.2126, 0.7152, 0.0722,
+		0.2126, 0.7152, 0.0722,
+		0.2126, 0.7152, 0.0722,
+	}}
+}
+
+// Sepia tints colors brown like an old photograph
+func Sepia() Filter {
+	return colorMatrix{name: "sepia", m: [9]float64{
+		0.393, 0.769, 0.189,
+		0.349, 0.686, 0.168,
+		0.272, 0.534, 0.131,
+	}}
+}
+
+// Saturation scales color saturation, 0 is grayscale and 1 is unchanged
+func Saturation(s float64) Filter {
+	// Same matrix as the CSS saturate() filter
+	return colorMatrix{name: fmt.Sprintf("saturation(%g)", s), m: [9]float64{
+		0.213 + 0.787*s, 0.715 - 0.715*s, 0.072 - 0.072*s,
+		0.213 - 0.213*s, 0.715 + 0.285*s, 0.072 - 0.072*s,
+		0.213 - 0.213*s, 0.715 - 0.715*s, 0.072 + 0.928*s,
+	}}
+}
+
+// HueRotate rotates hues by degrees while keeping luminance
+func HueRotate(degrees float64) Filter {
+	// Same matrix as the CSS hue-rotate() filter
+	cos := math.Cos(degrees * math.Pi / 180)
+	sin := math.Sin(degrees * math.Pi / 180)
+	return colorMatrix{name: fmt.Sprintf("hue-rotate(%g)", degrees), m: [9]float64{
+		0.213 + cos*0.787 - sin*0.213, 0.715 - cos*0.715 - sin*0.715, 0.072 - cos*0.072 + sin*0.928,
+		0.213 - cos*0.213 + sin*0.143, 0.715 + cos*0.285 + sin*0.140, 0.072 - cos*0.072 - sin*0.283,
+		0.213 - cos*0.213 - sin*0.787, 0.715 - cos*0.715 + sin*0.715, 0.072 + cos*0.928 + sin*0.072,
+	}}
+}
+
+// Tint multiplies colors by c, so that white becomes c and black stays
+// black. The alpha of c is the strength, 255 tints fully.
+func Tint(c color.NRGBA) Filter {
+	return tint{c}
+}
+
+type tint struct {
+	c color.NRGBA
+}
+
+func (f tint) Name() string {
+	return fmt.Sprintf("tint(#%02x%02x%02x%02x)", f.c.R, f.c.G, f.c.B, f.c.A)
+}
+
+func (f tint) Map(c color.NRGBA) color.NRGBA {
+	k := float64(f.c.A) / 255
+	mix := func(v, t uint8) uint8 {
+		return clamp8(float64(v) * (1 - k + k*float64(t)/255))
+	}
+	return color.NRGBA{R: mix(c.R, f.c.R), G: mix(c.G, f.c.G), B: mix(c.B, f.c.B), A: c.A}
+}
+
+// LUT remaps each channel through a 256 entry lookup table
+type LUT struct {
+	ID      string // distinguishes tables in cache keys
+	R, G, B [256]uint8
+}
+
+func (f *LUT) Name() string { return "lut(" + f.ID + ")" }
+
+func (f *LUT) Map(c color.NRGBA) color.NRGBA {
+	return color.NRGBA{R: f.R[c.R], G: f.G[c.G], B: f.B[c.B], A: c.A}
+}
+
+// NewLUT builds a lookup table applying fn to every channel value
+func NewLUT(id string, fn func(v uint8) uint8) *LUT {
+	lut := &LUT{ID: id}
+	for i := 0; i < 256; i++ {
+		v := fn(uint8(i))
+		lut.R[i], lut.G[i], lut.B[i] = v, v, v
+	}
+	return lut
+}
+
+// Invert inverts every channel
+func Invert() Filter {
+	return NewLUT("invert", func(v uint8) uint8 { return 255 - v })
+}
+
+// Brightness scales channel values, 1 is unchanged
+func Brightness(f float64) Filter {
+	return NewLUT(fmt.Sprintf("brightness(%g)", f), func(v uint8) uint8 {
+		return clamp8(float64(v) * f)
+	})
+}
+
+// Contrast scales channel values around mid gray, 1 is unchanged
+func Contrast(f float64) Filter {
+	return NewLUT(fmt.Sprintf("contrast(%g)", f), func(v uint8) uint8 {
+		return clamp8((float64(v)-127.5)*f + 127.5)
+	})
+}
+
+// Chain applies filters in order
+func Chain(filters ...Filter) Filter {
+	return chain(filters)
+}
+
+type chain []Filter
+
+func (f chain) Name() string {
+	names := make([]string, len(f))
+	for i, filter := range f {
+		names[i] = filter.Name()
+	}
+	return strings.Join(names, "|")
+}
+
+func (f chain) Map(c color.NRGBA) color.NRGBA {
+	for _, filter := range f {
+		c = filter.Map(c)
+	}
+	return c
+}
+
+// DarkMode inverts lightness while keeping hues, turning a light basemap
+// into a dark one with water still blue and parks still green
+func DarkMode() Filter {
+	return Chain(Invert(), HueRotate(180), Brightness(0.9), Contrast(0.9))
+}
+
+func clamp8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
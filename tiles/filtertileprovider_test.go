@@ -0,0 +1,69 @@
+package tiles
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// countingProvider serves solid tiles and counts the calls
+type countingProvider struct {
+	c     color.RGBA
+	calls int
+}
+
+func (p *countingProvider) GetTile(tile Tile) (image.Image, error) {
+	p.calls++
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(img, img.Bounds(), &image.Uniform{p.c}, image.Point{}, draw.Src)
+	return img, nil
+}
+
+func TestFilterTileProviderCachesPerFilter(t *testing.T) {
+	upstream := &countingProvider{c: color.RGBA{170, 211, 223, 255}}
+	p := NewFilterTileProvider(upstream, Grayscale())
+	tile := Tile{X: 1, Y: 2, Zoom: 3}
+
+	p.GetTile(tile)
+	p.GetTile(tile)
+	if upstream.calls != 1 {
+		t.Errorf("got %d upstream calls, want 1", upstream.calls)
+	}
+
+	p.SetFilter(DarkMode())
+	p.GetTile(tile)
+	p.SetFilter(Grayscale())
+	p.GetTile(tile)
+	if upstream.calls != 2 {
+		t.Errorf("got %d upstream calls after switching filters, want 2", upstream.calls)
+	}
+}
+
+func TestDarkModeKeepsHue(t *testing.T) {
+	water := DarkMode().Map(color.NRGBA{170, 211, 223, 255})
+	if water.B <= water.R || water.B > 128 {
+		t.Errorf("dark mode water %v should be dark and blue", water)
+	}
+}
+
+func TestTint(t *testing.T) {
+	red := Tint(color.NRGBA{R: 255, A: 255})
+	for _, tc := range []struct{ in, want color.NRGBA }{
+		{color.NRGBA{255, 255, 255, 255}, color.NRGBA{255, 0, 0, 255}},
+		{color.NRGBA{128, 128, 128, 100}, color.NRGBA{128, 0, 0, 100}},
+		{color.NRGBA{0, 0, 0, 255}, color.NRGBA{0, 0, 0, 255}},
+	} {
+		if got := red.Map(tc.in); got != tc.want {
+			t.Errorf("%v tinted to %v, want %v", tc.in, got, tc.want)
+		}
+	}
+
+	// Half strength
+	if got, want := Tint(color.NRGBA{A: 128}).Map(color.NRGBA{200, 200, 200, 255}), (color.NRGBA{100, 100, 100, 255}); got != want {
+		t.Errorf("half tint gives %v, want %v", got, want)
+	}
+	if Tint(color.NRGBA{R: 255, A: 255}).Name() == Tint(color.NRGBA{G: 255, A: 255}).Name() {
+		t.Error("tints of different colors share a cache key")
+	}
+}
@@ -0,0 +1,382 @@
+// Package geojson decodes GeoJSON (RFC 7946) into features with geometries
+// in geographical coordinates. Altitudes and other extra position elements
+// are read but dropped, since the map is flat.
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+// GeometryType is the "type" member of a geometry
+type GeometryType string
+
+const (
+	Point              GeometryType = "Point"
+	MultiPoint         GeometryType = "MultiPoint"
+	LineString         GeometryType = "LineString"
+	MultiLineString    GeometryType = "MultiLineString"
+	Polygon            GeometryType = "Polygon"
+	MultiPolygon       GeometryType = "MultiPolygon"
+	GeometryCollection GeometryType = "GeometryCollection"
+)
+
+// Geometry is a GeoJSON geometry. Single and multi geometries share the
+// fields of their kind, so a Point has one of Points and a MultiPolygon
+// any number of Polygons.
+type Geometry struct {
+	Type GeometryType
+	// Points of a Point or MultiPoint
+	Points []tiles.LatLng
+	// Lines of a LineString or MultiLineString
+	Lines [][]tiles.LatLng
+	// Polygons of a Polygon or MultiPolygon, each an exterior ring followed
+	// by its holes. Rings are closed, their last position repeats the first.
+	Polygons [][][]tiles.LatLng
+	// Geometries of a GeometryCollection
+	Geometries []*Geometry
+	BBox       []float64
+}
+
+// Feature is a geometry with properties. Geometry is nil for unlocated
+// features.
+type Feature struct {
+	// ID is a string or a float64, nil when absent
+	ID         any
+	Geometry   *Geometry
+	Properties map[string]any
+	BBox       []float64
+}
+
+// FeatureCollection is a list of features
+type FeatureCollection struct {
+	Features []*Feature
+	BBox     []float64
+}
+
+// object holds the members of any GeoJSON object
+type object struct {
+	Type        string            `json:"type"`
+	Features    []json.RawMessage `json:"features"`
+	Geometry    json.RawMessage   `json:"geometry"`
+	Geometries  []json.RawMessage `json:"geometries"`
+	Coordinates json.RawMessage   `json:"coordinates"`
+	Properties  map[string]any    `json:"properties"`
+	ID          any               `json:"id"`
+	BBox        []float64         `json:"bbox"`
+}
+
+// Parse decodes a FeatureCollection. A single Feature or geometry is
+// returned as a collection of one feature.
+func Parse(data []byte) (*FeatureCollection, error) {
+	var o object
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("geojson: %v", err)
+	}
+	if err := checkBBox(o.BBox); err != nil {
+		return nil, err
+	}
+	switch o.Type {
+	case "FeatureCollection":
+		fc := &FeatureCollection{Features: make([]*Feature, 0, len(o.Features)), BBox: o.BBox}
+		for i, raw := range o.Features {
+			f, err := parseFeature(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%v in feature %d", err, i)
+			}
+			fc.Features = append(fc.Features, f)
+		}
+		return fc, nil
+	case "Feature":
+		f, err := featureFromObject(o)
+		if err != nil {
+			return nil, err
+		}
+		return &FeatureCollection{Features: []*Feature{f}}, nil
+	default:
+		g, err := geometryFromObject(o)
+		if err != nil {
+			return nil, err
+		}
+		return &FeatureCollection{Features: []*Feature{{Geometry: g}}}, nil
+	}
+}
+
+// ReadFile parses the GeoJSON file path
+func ReadFile(path string) (*FeatureCollection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fc, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return fc, nil
+}
+
+func parseFeature(data []byte) (*Feature, error) {
+	var o object
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("geojson: %v", err)
+	}
+	if o.Type != "Feature" {
+		return nil, fmt.Errorf("geojson: type %q, want Feature", o.Type)
+	}
+	if err := checkBBox(o.BBox); err != nil {
+		return nil, err
+	}
+	return featureFromObject(o)
+}
+
+func featureFromObject(o object) (*Feature, error) {
+	switch o.ID.(type) {
+	case nil, string, float64:
+	default:
+		return nil, fmt.Errorf("geojson: feature id is not a string or number")
+	}
+	f := &Feature{ID: o.ID, Properties: o.Properties, BBox: o.BBox}
+	if f.Properties == nil {
+		f.Properties = map[string]any{}
+	}
+	if len(o.Geometry) == 0 || string(o.Geometry) == "null" {
+		return f, nil
+	}
+	g, err := parseGeometry(o.Geometry)
+	if err != nil {
+		return nil, err
+	}
+	f.Geometry = g
+	return f, nil
+}
+
+func parseGeometry(data []byte) (*Geometry, error) {
+	var o object
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("geojson: %v", err)
+	}
+	if err := checkBBox(o.BBox); err != nil {
+		return nil, err
+	}
+	return geometryFromObject(o)
+}
+
+func geometryFromObject(o object) (*Geometry, error) {
+	g := &Geometry{Type: GeometryType(o.Type), BBox: o.BBox}
+	if g.Type == GeometryCollection {
+		for _, raw := range o.Geometries {
+			child, err := parseGeometry(raw)
+			if err != nil {
+				return nil, err
+			}
+			g.Geometries = append(g.Geometries, child)
+		}
+		return g, nil
+	}
+	if len(o.Coordinates) == 0 {
+		return nil, fmt.Errorf("geojson: %s without coordinates", o.Type)
+	}
+
+	var err error
+	switch g.Type {
+	case Point:
+		var c []float64
+		if err = unmarshalCoordinates(o.Coordinates, &c); err == nil {
+			var p tiles.LatLng
+			p, err = position(c)
+			g.Points = []tiles.LatLng{p}
+		}
+	case MultiPoint:
+		var c [][]float64
+		if err = unmarshalCoordinates(o.Coordinates, &c); err == nil {
+			g.Points, err = positions(c)
+		}
+	case LineString:
+		var c [][]float64
+		if err = unmarshalCoordinates(o.Coordinates, &c); err == nil {
+			var line []tiles.LatLng
+			line, err = lineString(c)
+			g.Lines = [][]tiles.LatLng{line}
+		}
+	case MultiLineString:
+		var c [][][]float64
+		if err = unmarshalCoordinates(o.Coordinates, &c); err == nil {
+			g.Lines = make([][]tiles.LatLng, len(c))
+			for i := range c {
+				if g.Lines[i], err = lineString(c[i]); err != nil {
+					break
+				}
+			}
+		}
+	case Polygon:
+		var c [][][]float64
+		if err = unmarshalCoordinates(o.Coordinates, &c); err == nil {
+			var rings [][]tiles.LatLng
+			rings, err = polygon(c)
+			g.Polygons = [][][]tiles.LatLng{rings}
+		}
+	case MultiPolygon:
+		var c [][][][]float64
+		if err = unmarshalCoordinates(o.Coordinates, &c); err == nil {
+			g.Polygons = make([][][]tiles.LatLng, len(c))
+			for i := range c {
+				if g.Polygons[i], err = polygon(c[i]); err != nil {
+					break
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("geojson: unknown type %q", o.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("geojson: %s: %v", o.Type, err)
+	}
+	return g, nil
+}
+
+func unmarshalCoordinates(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("bad coordinates: %v", err)
+	}
+	return nil
+}
+
+// position converts [longitude, latitude, ...] to a LatLng
+func position(c []float64) (tiles.LatLng, error) {
+	if len(c) < 2 {
+		return tiles.LatLng{}, fmt.Errorf("position with %d elements", len(c))
+	}
+	if c[1] < -90 || c[1] > 90 || math.IsNaN(c[0]) || math.IsInf(c[0], 0) {
+		return tiles.LatLng{}, fmt.Errorf("position %v out of range", c)
+	}
+	return tiles.LatLng{Lat: c[1], Lng: c[0]}, nil
+}
+
+func positions(c [][]float64) ([]tiles.LatLng, error) {
+	pts := make([]tiles.LatLng, len(c))
+	for i := range c {
+		p, err := position(c[i])
+		if err != nil {
+			return nil, err
+		}
+		pts[i] = p
+	}
+	return pts, nil
+}
+
+func lineString(c [][]float64) ([]tiles.LatLng, error) {
+	if len(c) < 2 {
+		return nil, fmt.Errorf("line with %d positions", len(c))
+	}
+	return positions(c)
+}
+
+func polygon(c [][][]float64) ([][]tiles.LatLng, error) {
+	rings := make([][]tiles.LatLng, len(c))
+	for i := range c {
+		ring, err := positions(c[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(ring) < 4 {
+			return nil, fmt.Errorf("ring with %d positions", len(ring))
+		}
+		if ring[0] != ring[len(ring)-1] {
+			return nil, fmt.Errorf("ring is not closed")
+		}
+		rings[i] = ring
+	}
+	return rings, nil
+}
+
+func checkBBox(b []float64) error {
+	if b != nil && len(b) != 4 && len(b) != 6 {
+		return fmt.Errorf("geojson: bbox with %d values", len(b))
+	}
+	return nil
+}
+
+// Bounds returns the bounds of the features, from the bbox of the
+// collection when it has one
+func (fc *FeatureCollection) Bounds() (tiles.LatLngBounds, bool) {
+	if b, ok := bboxBounds(fc.BBox); ok {
+		return b, true
+	}
+	var e extent
+	for _, f := range fc.Features {
+		if f.Geometry != nil {
+			f.Geometry.extend(&e)
+		}
+	}
+	return e.bounds()
+}
+
+// Bounds returns the bounds of the geometry, from its bbox when it has one
+func (g *Geometry) Bounds() (tiles.LatLngBounds, bool) {
+	if b, ok := bboxBounds(g.BBox); ok {
+		return b, true
+	}
+	var e extent
+	g.extend(&e)
+	return e.bounds()
+}
+
+// bboxBounds converts [west, south, east, north] or its 3D form
+func bboxBounds(b []float64) (tiles.LatLngBounds, bool) {
+	n := len(b) / 2
+	if n != 2 && n != 3 {
+		return tiles.LatLngBounds{}, false
+	}
+	return tiles.LatLngBounds{
+		NorthWest: tiles.LatLng{Lat: b[n+1], Lng: b[0]},
+		SouthEast: tiles.LatLng{Lat: b[1], Lng: b[n]},
+	}, true
+}
+
+// extent accumulates the bounds of positions
+type extent struct {
+	b   tiles.LatLngBounds
+	set bool
+}
+
+func (e *extent) add(p tiles.LatLng) {
+	if !e.set {
+		e.b = tiles.LatLngBounds{NorthWest: p, SouthEast: p}
+		e.set = true
+		return
+	}
+	e.b.NorthWest.Lat = max(e.b.NorthWest.Lat, p.Lat)
+	e.b.NorthWest.Lng = min(e.b.NorthWest.Lng, p.Lng)
+	e.b.SouthEast.Lat = min(e.b.SouthEast.Lat, p.Lat)
+	e.b.SouthEast.Lng = max(e.b.SouthEast.Lng, p.Lng)
+}
+
+func (e *extent) bounds() (tiles.LatLngBounds, bool) {
+	return e.b, e.set
+}
+
+func (g *Geometry) extend(e *extent) {
+	for _, p := range g.Points {
+		e.add(p)
+	}
+	for _, line := range g.Lines {
+		for _, p := range line {
+			e.add(p)
+		}
+	}
+	for _, rings := range g.Polygons {
+		// Holes are inside the exterior ring
+		if len(rings) > 0 {
+			for _, p := range rings[0] {
+				e.add(p)
+			}
+		}
+	}
+	for _, child := range g.Geometries {
+		child.extend(e)
+	}
+}
@@ -0,0 +1,107 @@
+package geojson
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/olablt/gio-tiles/tiles"
+)
+
+const collection = `{
+  "type": "FeatureCollection",
+  "features": [
+    {"type": "Feature", "id": "a", "properties": {"name": "Vilnius", "pop": 588412},
+     "geometry": {"type": "Point", "coordinates": [25.28, 54.69, 112]}},
+    {"type": "Feature", "id": 2, "properties": null,
+     "geometry": {"type": "MultiPoint", "coordinates": [[1, 2], [3, 4]]}},
+    {"type": "Feature", "properties": {},
+     "geometry": {"type": "LineString", "coordinates": [[0, 0], [1, 1]]}},
+    {"type": "Feature", "properties": {},
+     "geometry": {"type": "MultiLineString", "coordinates": [[[0, 0], [1, 1]], [[2, 2], [3, 3]]]}},
+    {"type": "Feature", "properties": {"kind": "lake"}, "bbox": [0, 0, 10, 10],
+     "geometry": {"type": "Polygon", "coordinates": [
+       [[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]],
+       [[2, 2], [2, 8], [8, 8], [8, 2], [2, 2]]]}},
+    {"type": "Feature", "properties": {},
+     "geometry": {"type": "MultiPolygon", "coordinates": [
+       [[[0, 0], [1, 0], [1, 1], [0, 0]]],
+       [[[5, 5], [6, 5], [6, 6], [5, 5]]]]}},
+    {"type": "Feature", "properties": {},
+     "geometry": {"type": "GeometryCollection", "geometries": [
+       {"type": "Point", "coordinates": [-30, -40]},
+       {"type": "LineString", "coordinates": [[0, 0], [1, 1]]}]}},
+    {"type": "Feature", "properties": {"note": "unlocated"}, "geometry": null}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	fc, err := Parse([]byte(collection))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.Features) != 8 {
+		t.Fatalf("got %d features, want 8", len(fc.Features))
+	}
+	f := fc.Features[0]
+	if f.ID != "a" || f.Properties["name"] != "Vilnius" || f.Properties["pop"] != 588412.0 {
+		t.Errorf("feature %+v", f)
+	}
+	if g := f.Geometry; g.Type != Point || len(g.Points) != 1 || g.Points[0] != (tiles.LatLng{Lat: 54.69, Lng: 25.28}) {
+		t.Errorf("point %+v", g)
+	}
+	if f := fc.Features[1]; f.ID != 2.0 || f.Properties == nil || len(f.Geometry.Points) != 2 {
+		t.Errorf("multipoint feature %+v", f)
+	}
+	if g := fc.Features[3].Geometry; len(g.Lines) != 2 || g.Lines[1][1] != (tiles.LatLng{Lat: 3, Lng: 3}) {
+		t.Errorf("multilinestring %+v", g)
+	}
+	if f := fc.Features[4]; len(f.BBox) != 4 || len(f.Geometry.Polygons) != 1 || len(f.Geometry.Polygons[0]) != 2 {
+		t.Errorf("polygon feature %+v", f)
+	}
+	if g := fc.Features[5].Geometry; len(g.Polygons) != 2 {
+		t.Errorf("multipolygon %+v", g)
+	}
+	if g := fc.Features[6].Geometry; g.Type != GeometryCollection || len(g.Geometries) != 2 || g.Geometries[1].Type != LineString {
+		t.Errorf("geometry collection %+v", g)
+	}
+	if f := fc.Features[7]; f.Geometry != nil {
+		t.Errorf("unlocated feature has geometry %+v", f.Geometry)
+	}
+
+	b, ok := fc.Bounds()
+	want := tiles.LatLngBounds{NorthWest: tiles.LatLng{Lat: 54.69, Lng: -30}, SouthEast: tiles.LatLng{Lat: -40, Lng: 25.28}}
+	if !ok || b != want {
+		t.Errorf("bounds %+v, want %+v", b, want)
+	}
+}
+
+func TestParseSingle(t *testing.T) {
+	fc, err := Parse([]byte(`{"type": "Point", "coordinates": [1, 2], "bbox": [1, 2, 1, 2]}`))
+	if err != nil || len(fc.Features) != 1 || fc.Features[0].Geometry.Type != Point {
+		t.Fatalf("geometry parsed to %+v, %v", fc, err)
+	}
+	fc, err = Parse([]byte(`{"type": "Feature", "properties": {"a": 1}, "geometry": null}`))
+	if err != nil || len(fc.Features) != 1 || fc.Features[0].Properties["a"] != 1.0 {
+		t.Fatalf("feature parsed to %+v, %v", fc, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct{ json, err string }{
+		{`{"type": "Point", "coordinates": [1]}`, "position with 1 elements"},
+		{`{"type": "Point", "coordinates": [1, 95]}`, "out of range"},
+		{`{"type": "LineString", "coordinates": [[1, 2]]}`, "line with 1 positions"},
+		{`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1]]]}`, "not closed"},
+		{`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [0, 0]]]}`, "ring with 3 positions"},
+		{`{"type": "Circle", "coordinates": [0, 0]}`, "unknown type"},
+		{`{"type": "Point", "coordinates": [0, 0], "bbox": [0, 0, 1]}`, "bbox with 3 values"},
+		{`{"type": "FeatureCollection", "features": [{"type": "Point", "coordinates": [0, 0]}]}`, "want Feature in feature 0"},
+		{`{"type": "FeatureCollection", "features": [{"type": "Feature", "id": true}]}`, "id is not a string or number"},
+		{`{"type": `, "unexpected end"},
+	} {
+		_, err := Parse([]byte(tc.json))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: error %v, want %q", tc.json, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package tiles
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+)
+
+const earthRadius = 6378137.0 // WGS84 semi-major axis in meters
+
+// ErrNoCoverage is returned for tiles that do not intersect a raster
+var ErrNoCoverage = errors.New("tile outside raster coverage")
+
+// CRS identifies a coordinate reference system by its EPSG code
+type CRS int
+
+const (
+	CRSUnknown CRS = 0
+	EPSG4326   CRS = 4326 // WGS84 longitude/latitude in degrees
+	EPSG3857   CRS = 3857 // Web Mercator in meters
+)
+
+// Sampling selects how raster pixels are resampled into tiles
+type Sampling int
+
+const (
+	SampleNearest Sampling = iota
+	SampleBilinear
+)
+
+// GeoTransform maps raster pixel coordinates to CRS coordinates using the
+// GDAL coefficient order:
+//
+//	x = t[0] + col*t[1] + row*t[2]
+//	y = t[3] + col*t[4] + row*t[5]
+type GeoTransform [6]float64
+
+// Apply converts raster pixel coordinates to CRS coordinates
+func (t GeoTransform) Apply(col, row float64) (x, y float64) {
+	return t[0] + col*t[1] + row*t[2], t[3] + col*t[4] + row*t[5]
+}
+
+// Invert returns the transform mapping CRS coordinates back to pixels
+func (t GeoTransform) Invert() (GeoTransform, bool) {
+	det := t[1]*t[5] - t[2]*t[4]
+	if det == 0 {
+		return GeoTransform{}, false
+	}
+	return GeoTransform{
+		(t[2]*t[3] - t[0]*t[5]) / det,
+		t[5] / det,
+		-t[2] / det,
+		(t[0]*t[4] - t[1]*t[3]) / det,
+		-t[4] / det,
+		t[1] / det,
+	}, true
+}
+
+// LatLngBounds is a geographical rectangle
+type LatLngBounds struct {
+	NorthWest, SouthEast LatLng
+}
+
+// GeoRaster is an image georeferenced in EPSG:4326 or EPSG:3857
+type GeoRaster struct {
+	Image     image.Image
+	Transform GeoTransform
+	CRS       CRS
+	// NoData marks pixels whose color samples all equal this value as
+	// transparent when HasNoData is set. The value is in the image's own
+	// sample depth, e.g. 0-255 for 8-bit images.
+	NoData    float64
+	HasNoData bool
+	// SampleBits is the bit depth NoData is expressed in, 8 when zero
+	SampleBits int
+}
+
+// Bounds returns the geographical extent of the raster
+func (r *GeoRaster) Bounds() LatLngBounds {
+	minX, minY, maxX, maxY := r.extent()
+	nw := crsToLatLng(r.CRS, minX, maxY)
+	se := crsToLatLng(r.CRS, maxX, minY)
+	return LatLngBounds{NorthWest: nw, SouthEast: se}
+}
+
+// extent returns the raster's bounding box in CRS coordinates
+func (r *GeoRaster) extent() (minX, minY, maxX, maxY float64) {
+	b := r.Image.Bounds()
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, c := range [][2]float64{
+		{0, 0}, {float64(b.Dx()), 0}, {0, float64(b.Dy())}, {float64(b.Dx()), float64(b.Dy())},
+	} {
+		x, y := r.Transform.Apply(c[0], c[1])
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	return minX, minY, maxX, maxY
+}
+
+// RenderTile reprojects the raster into a size x size tile. It returns
+// ErrNoCoverage when the tile does not intersect the raster.
+func (r *GeoRaster) RenderTile(tile Tile, size int, sampling Sampling) (*image.RGBA, error) {
+	inv, ok := r.Transform.Invert()
+	if !ok {
+		return nil, errors.New("georaster: singular geotransform")
+	}
+
+	// Both supported CRSs are separable in web mercator world space, so the
+	// CRS coordinates of every column and row are computed once
+	zoom := float64(tile.Zoom)
+	scale := float64(TileSize) / float64(size)
+	xs := make([]float64, size)
+	ys := make([]float64, size)
+	for i := 0; i < size; i++ {
+		worldX := (float64(tile.X*size+i) + 0.5) * scale
+		worldY := (float64(tile.Y*size+i) + 0.5) * scale
+		xs[i], _ = worldToCRS(r.CRS, worldX, 0, zoom)
+		_, ys[i] = worldToCRS(r.CRS, 0, worldY, zoom)
+	}
+
+	minX, minY, maxX, maxY := r.extent()
+	if xs[size-1] < minX || xs[0] > maxX || ys[0] < minY || ys[size-1] > maxY {
+		return nil, ErrNoCoverage
+	}
+
+	b := r.Image.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for row := 0; row < size; row++ {
+		for col := 0; col < size; col++ {
+			px, py := inv.Apply(xs[col], ys[row])
+			if px < 0 || py < 0 || px >= float64(b.Dx()) || py >= float64(b.Dy()) {
+				continue
+			}
+			var c color.RGBA64
+			var valid bool
+			if sampling == SampleBilinear {
+				c, valid = r.bilinear(px, py)
+			} else {
+				c, valid = r.at(int(px), int(py))
+			}
+			if valid {
+				off := dst.PixOffset(col, row)
+				dst.Pix[off+0] = uint8(c.R >> 8)
+				dst.Pix[off+1] = uint8(c.G >> 8)
+				dst.Pix[off+2] = uint8(c.B >> 8)
+				dst.Pix[off+3] = uint8(c.A >> 8)
+			}
+		}
+	}
+	return dst, nil
+}
+
+// at returns the premultiplied color of a pixel relative to the image
+// origin, and false for nodata pixels
+func (r *GeoRaster) at(x, y int) (color.RGBA64, bool) {
+	b := r.Image.Bounds()
+	c := r.Image.At(b.Min.X+x, b.Min.Y+y)
+	if r.HasNoData {
+		nd := uint32(r.NoData)
+		if r.SampleBits <= 8 {
+			nd *= 0x101
+		}
+		if sr, sg, sb := samples(c); sr == nd && sg == nd && sb == nd {
+			return color.RGBA64{}, false
+		}
+	}
+	cr, cg, cb, ca := c.RGBA()
+	return color.RGBA64{R: uint16(cr), G: uint16(cg), B: uint16(cb), A: uint16(ca)}, true
+}
+
+// samples returns the color samples of c as stored, scaled to 16 bits.
+// Unlike c.RGBA they are not premultiplied by alpha, which would change
+// them in pixels that are not opaque.
+func samples(c color.Color) (r, g, b uint32) {
+	switch c := c.(type) {
+	case color.NRGBA:
+		return uint32(c.R) * 0x101, uint32(c.G) * 0x101, uint32(c.B) * 0x101
+	case color.NRGBA64:
+		return uint32(c.R), uint32(c.G), uint32(c.B)
+	case color.RGBA:
+		return uint32(c.R) * 0x101, uint32(c.G) * 0x101, uint32(c.B) * 0x101
+	case color.RGBA64:
+		return uint32(c.R), uint32(c.G), uint32(c.B)
+	}
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	return uint32(n.R), uint32(n.G), uint32(n.B)
+}
+
+// bilinear interpolates between the four pixels around a pixel-space
+// position. It falls back to the nearest pixel next to nodata and edges.
+func (r *GeoRaster) bilinear(px, py float64) (color.RGBA64, bool) {
+	b := r.Image.Bounds()
+	fx, fy := px-0.5, py-0.5
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	if x0 < 0 || y0 < 0 || x0+1 >= b.Dx() || y0+1 >= b.Dy() {
+		return r.at(int(px), int(py))
+	}
+	c00, ok00 := r.at(x0, y0)
+	c10, ok10 := r.at(x0+1, y0)
+	c01, ok01 := r.at(x0, y0+1)
+	c11, ok11 := r.at(x0+1, y0+1)
+	if !ok00 || !ok10 || !ok01 || !ok11 {
+		return r.at(int(px), int(py))
+	}
+	wx, wy := fx-float64(x0), fy-float64(y0)
+	lerp := func(a, b, c, d uint16) uint16 {
+		top := float64(a)*(1-wx) + float64(b)*wx
+		bottom := float64(c)*(1-wx) + float64(d)*wx
+		return uint16(top*(1-wy) + bottom*wy + 0.5)
+	}
+	return color.RGBA64{
+		R: lerp(c00.R, c10.R, c01.R, c11.R),
+		G: lerp(c00.G, c10.G, c01.G, c11.G),
+		B: lerp(c00.B, c10.B, c01.B, c11.B),
+		A: lerp(c00.A, c10.A, c01.A, c11.A),
+	}, true
+}
+
+// worldToCRS converts world pixel coordinates at zoom to CRS coordinates
+func worldToCRS(crs CRS, worldX, worldY, zoom float64) (float64, float64) {
+	worldSize := float64(TileSize) * math.Pow(2, zoom)
+	switch crs {
+	case EPSG3857:
+		return (worldX/worldSize - 0.5) * 2 * math.Pi * earthRadius,
+			(0.5 - worldY/worldSize) * 2 * math.Pi * earthRadius
+	default:
+		ll := WorldToLatLng(worldX, worldY, zoom)
+		return ll.Lng, ll.Lat
+	}
+}
+
+// crsToLatLng converts CRS coordinates to geographical coordinates
+func crsToLatLng(crs CRS, x, y float64) LatLng {
+	switch crs {
+	case EPSG3857:
+		return LatLng{
+			Lat: (2*math.Atan(math.Exp(y/earthRadius)) - math.Pi/2) * 180 / math.Pi,
+			Lng: x / earthRadius * 180 / math.Pi,
+		}
+	default:
+		return LatLng{Lat: y, Lng: x}
+	}
+}
@@ -0,0 +1,302 @@
+package tiles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/tiff"
+)
+
+// TIFF and GeoTIFF tags read by the GeoTIFF provider
+const (
+	tagBitsPerSample       = 258
+	tagModelPixelScale     = 33550
+	tagModelTiepoint       = 33922
+	tagModelTransformation = 34264
+	tagGeoKeyDirectory     = 34735
+	tagGDALNoData          = 42113
+	geoKeyModelType        = 1024
+	geoKeyRasterType       = 1025
+	geoKeyGeographicType   = 2048
+	geoKeyProjectedCSType  = 3072
+	modelTypeProjected     = 1
+	modelTypeGeographic    = 2
+	rasterPixelIsPoint     = 2
+)
+
+// GeoTIFFOptions configures GeoTIFFProvider
+type GeoTIFFOptions struct {
+	Sampling Sampling
+	TileSize int // edge length in pixels, TileSize when zero
+	// NoData overrides the GDAL_NODATA tag of the file
+	NoData *float64
+	// CRS is used when the file has no GeoKeys for a supported CRS
+	CRS CRS
+}
+
+// GeoTIFFProvider serves a local GeoTIFF reprojected into slippy map tiles.
+// Tiles outside the raster fail with ErrNoCoverage, and nodata pixels are
+// transparent.
+type GeoTIFFProvider struct {
+	raster *GeoRaster
+	opts   GeoTIFFOptions
+}
+
+func NewGeoTIFFProvider(path string, opts GeoTIFFOptions) (*GeoTIFFProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raster, err := DecodeGeoTIFF(data)
+	if err != nil {
+		return nil, fmt.Errorf("geotiff %s: %v", path, err)
+	}
+	if raster.CRS == CRSUnknown {
+		if opts.CRS == CRSUnknown {
+			return nil, fmt.Errorf("geotiff %s: unsupported or missing CRS", path)
+		}
+		raster.CRS = opts.CRS
+	}
+	if opts.NoData != nil {
+		raster.NoData = *opts.NoData
+		raster.HasNoData = true
+	}
+	if opts.TileSize <= 0 {
+		opts.TileSize = TileSize
+	}
+	return &GeoTIFFProvider{raster: raster, opts: opts}, nil
+}
+
+// Raster returns the decoded and georeferenced image
+func (p *GeoTIFFProvider) Raster() *GeoRaster {
+	return p.raster
+}
+
+// Bounds returns the geographical extent of the GeoTIFF
+func (p *GeoTIFFProvider) Bounds() LatLngBounds {
+	return p.raster.Bounds()
+}
+
+func (p *GeoTIFFProvider) GetTile(tile Tile) (image.Image, error) {
+	return p.raster.RenderTile(tile, p.opts.TileSize, p.opts.Sampling)
+}
+
+// DecodeGeoTIFF decodes a stripped or tiled GeoTIFF and its georeference.
+// The CRS is CRSUnknown when the GeoKeys name neither EPSG:4326 nor
+// EPSG:3857.
+func DecodeGeoTIFF(data []byte) (*GeoRaster, error) {
+	tags, err := readTIFFTags(data)
+	if err != nil {
+		return nil, err
+	}
+	img, err := tiff.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	raster := &GeoRaster{Image: img, SampleBits: 8}
+	if bits := tags.uints(tagBitsPerSample); len(bits) > 0 {
+		raster.SampleBits = int(bits[0])
+	}
+
+	keys := tags.geoKeys()
+	raster.CRS = keys.crs()
+
+	switch {
+	case len(tags.doubles(tagModelTransformation)) == 16:
+		m := tags.doubles(tagModelTransformation)
+		raster.Transform = GeoTransform{m[3], m[0], m[1], m[7], m[4], m[5]}
+	case len(tags.doubles(tagModelTiepoint)) >= 6 && len(tags.doubles(tagModelPixelScale)) >= 2:
+		tp := tags.doubles(tagModelTiepoint)
+		scale := tags.doubles(tagModelPixelScale)
+		raster.Transform = GeoTransform{
+			tp[3] - tp[0]*scale[0], scale[0], 0,
+			tp[4] + tp[1]*scale[1], 0, -scale[1],
+		}
+	default:
+		return nil, fmt.Errorf("no georeference tags")
+	}
+
+	// Transforms are kept in PixelIsArea convention, where the tiepoint
+	// refers to the corner of the pixel rather than its center
+	if keys[geoKeyRasterType] == rasterPixelIsPoint {
+		t := raster.Transform
+		raster.Transform[0] -= (t[1] + t[2]) / 2
+		raster.Transform[3] -= (t[4] + t[5]) / 2
+	}
+
+	if s := tags.ascii(tagGDALNoData); s != "" {
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			raster.NoData = v
+			raster.HasNoData = true
+		}
+	}
+	return raster, nil
+}
+
+// tiffTags holds the raw values of the interesting tags of the first IFD
+type tiffTags struct {
+	order  binary.ByteOrder
+	values map[uint16]tiffValue
+}
+
+type tiffValue struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// readTIFFTags parses the first image file directory of a classic TIFF
+func readTIFFTags(data []byte) (*tiffTags, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("tiff: file too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("tiff: bad byte order marker")
+	}
+	if magic := order.Uint16(data[2:4]); magic != 42 {
+		return nil, fmt.Errorf("tiff: unsupported version %d", magic)
+	}
+
+	ifd := int(order.Uint32(data[4:8]))
+	if ifd+2 > len(data) {
+		return nil, fmt.Errorf("tiff: IFD offset out of range")
+	}
+	n := int(order.Uint16(data[ifd : ifd+2]))
+	tags := &tiffTags{order: order, values: make(map[uint16]tiffValue)}
+	for i := 0; i < n; i++ {
+		e := ifd + 2 + i*12
+		if e+12 > len(data) {
+			return nil, fmt.Errorf("tiff: truncated IFD")
+		}
+		tag := order.Uint16(data[e : e+2])
+		typ := order.Uint16(data[e+2 : e+4])
+		count := order.Uint32(data[e+4 : e+8])
+		size := tiffTypeSize(typ) * int(count)
+		if size == 0 {
+			continue
+		}
+		// Values of up to four bytes are stored in the entry itself
+		var raw []byte
+		if size <= 4 {
+			raw = data[e+8 : e+8+size]
+		} else {
+			off := int(order.Uint32(data[e+8 : e+12]))
+			if off < 0 || off+size > len(data) {
+				return nil, fmt.Errorf("tiff: tag %d out of range", tag)
+			}
+			raw = data[off : off+size]
+		}
+		tags.values[tag] = tiffValue{typ: typ, count: count, data: raw}
+	}
+	return tags, nil
+}
+
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+func (t *tiffTags) uints(tag uint16) []uint32 {
+	v, ok := t.values[tag]
+	if !ok {
+		return nil
+	}
+	out := make([]uint32, v.count)
+	for i := range out {
+		switch v.typ {
+		case 1:
+			out[i] = uint32(v.data[i])
+		case 3:
+			out[i] = uint32(t.order.Uint16(v.data[i*2:]))
+		case 4:
+			out[i] = t.order.Uint32(v.data[i*4:])
+		default:
+			return nil
+		}
+	}
+	return out
+}
+
+func (t *tiffTags) doubles(tag uint16) []float64 {
+	v, ok := t.values[tag]
+	if !ok {
+		return nil
+	}
+	out := make([]float64, v.count)
+	for i := range out {
+		switch v.typ {
+		case 11:
+			out[i] = float64(math.Float32frombits(t.order.Uint32(v.data[i*4:])))
+		case 12:
+			out[i] = math.Float64frombits(t.order.Uint64(v.data[i*8:]))
+		default:
+			return nil
+		}
+	}
+	return out
+}
+
+func (t *tiffTags) ascii(tag uint16) string {
+	v, ok := t.values[tag]
+	if !ok || v.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(v.data), "\x00"))
+}
+
+// geoKeys holds the SHORT valued keys of the GeoKeyDirectory
+type geoKeys map[uint16]uint32
+
+func (t *tiffTags) geoKeys() geoKeys {
+	keys := geoKeys{}
+	dir := t.uints(tagGeoKeyDirectory)
+	if len(dir) < 4 {
+		return keys
+	}
+	for i := 0; i < int(dir[3]) && 4+i*4+3 < len(dir); i++ {
+		entry := dir[4+i*4 : 8+i*4]
+		// A location of zero means the value is stored inline
+		if entry[1] == 0 {
+			keys[uint16(entry[0])] = entry[3]
+		}
+	}
+	return keys
+}
+
+// crs maps the model type and EPSG codes of the GeoKeys to a CRS
+func (k geoKeys) crs() CRS {
+	switch k[geoKeyModelType] {
+	case modelTypeGeographic:
+		if code := k[geoKeyGeographicType]; code == 4326 || code == 0 {
+			return EPSG4326
+		}
+	case modelTypeProjected:
+		switch k[geoKeyProjectedCSType] {
+		case 3857, 3785, 900913:
+			return EPSG3857
+		}
+	}
+	return CRSUnknown
+}
@@ -0,0 +1,261 @@
+package tiles
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"testing"
+)
+
+// tiffEntry is a tag of a TIFF built by buildTIFF. value is a []uint16,
+// []uint32, []float64 or string.
+type tiffEntry struct {
+	tag   uint16
+	value any
+}
+
+// buildTIFF encodes an uncompressed little-endian TIFF of 8-bit samples
+// in a single strip, with the extra tags
+func buildTIFF(width, height, samples int, pix []byte, extra ...tiffEntry) []byte {
+	photometric := uint16(1) // BlackIsZero
+	if samples >= 3 {
+		photometric = 2 // RGB
+	}
+	bits := make([]uint16, samples)
+	for i := range bits {
+		bits[i] = 8
+	}
+	entries := []tiffEntry{
+		{256, []uint32{uint32(width)}},
+		{257, []uint32{uint32(height)}},
+		{258, bits},
+		{259, []uint16{1}},
+		{262, []uint16{photometric}},
+		{273, []uint32{8}},
+		{277, []uint16{uint16(samples)}},
+		{278, []uint32{uint32(height)}},
+		{279, []uint32{uint32(len(pix))}},
+	}
+	if samples == 4 {
+		entries = append(entries, tiffEntry{338, []uint16{2}}) // unassociated alpha
+	}
+	entries = append(entries, extra...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	le := binary.LittleEndian
+	data := []byte("II*\x00\x00\x00\x00\x00")
+	data = append(data, pix...)
+	type encoded struct {
+		typ   uint16
+		count int
+		raw   []byte
+	}
+	enc := make([]encoded, len(entries))
+	for i, e := range entries {
+		switch v := e.value.(type) {
+		case []uint16:
+			enc[i] = encoded{3, len(v), nil}
+			for _, x := range v {
+				enc[i].raw = le.AppendUint16(enc[i].raw, x)
+			}
+		case []uint32:
+			enc[i] = encoded{4, len(v), nil}
+			for _, x := range v {
+				enc[i].raw = le.AppendUint32(enc[i].raw, x)
+			}
+		case []float64:
+			enc[i] = encoded{12, len(v), nil}
+			for _, x := range v {
+				enc[i].raw = le.AppendUint64(enc[i].raw, math.Float64bits(x))
+			}
+		case string:
+			enc[i] = encoded{2, len(v) + 1, append([]byte(v), 0)}
+		}
+	}
+	// Values longer than four bytes go before the IFD
+	offsets := make([]int, len(enc))
+	for i, e := range enc {
+		if len(e.raw) > 4 {
+			if len(data)%2 == 1 {
+				data = append(data, 0)
+			}
+			offsets[i] = len(data)
+			data = append(data, e.raw...)
+		}
+	}
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	le.PutUint32(data[4:], uint32(len(data)))
+	data = le.AppendUint16(data, uint16(len(enc)))
+	for i, e := range enc {
+		data = le.AppendUint16(data, entries[i].tag)
+		data = le.AppendUint16(data, e.typ)
+		data = le.AppendUint32(data, uint32(e.count))
+		if len(e.raw) > 4 {
+			data = le.AppendUint32(data, uint32(offsets[i]))
+		} else {
+			var inline [4]byte
+			copy(inline[:], e.raw)
+			data = append(data, inline[:]...)
+		}
+	}
+	return le.AppendUint32(data, 0)
+}
+
+// geoKeyDir returns a GeoKeyDirectory of inline keys and values
+func geoKeyDir(kv ...uint16) tiffEntry {
+	dir := []uint16{1, 1, 0, uint16(len(kv) / 2)}
+	for i := 0; i < len(kv); i += 2 {
+		dir = append(dir, kv[i], 0, 1, kv[i+1])
+	}
+	return tiffEntry{tagGeoKeyDirectory, dir}
+}
+
+func TestDecodeGeoTIFF(t *testing.T) {
+	pix := []byte{0, 50, 100, 150, 200, 250, 10, 20}
+	tiepoint := tiffEntry{tagModelTiepoint, []float64{0, 0, 0, 10, 50, 0}}
+	scale := tiffEntry{tagModelPixelScale, []float64{0.5, 0.25, 0}}
+	for _, tc := range []struct {
+		name      string
+		tags      []tiffEntry
+		crs       CRS
+		transform GeoTransform
+	}{
+		{
+			"geographic, pixel is area",
+			[]tiffEntry{tiepoint, scale, geoKeyDir(geoKeyModelType, modelTypeGeographic, geoKeyRasterType, 1, geoKeyGeographicType, 4326)},
+			EPSG4326, GeoTransform{10, 0.5, 0, 50, 0, -0.25},
+		},
+		{
+			// The tiepoint is the center of the first pixel
+			"geographic, pixel is point",
+			[]tiffEntry{tiepoint, scale, geoKeyDir(geoKeyModelType, modelTypeGeographic, geoKeyRasterType, rasterPixelIsPoint)},
+			EPSG4326, GeoTransform{9.75, 0.5, 0, 50.125, 0, -0.25},
+		},
+		{
+			"web mercator",
+			[]tiffEntry{tiepoint, scale, geoKeyDir(geoKeyModelType, modelTypeProjected, geoKeyProjectedCSType, 3857)},
+			EPSG3857, GeoTransform{10, 0.5, 0, 50, 0, -0.25},
+		},
+		{
+			"unsupported projection",
+			[]tiffEntry{tiepoint, scale, geoKeyDir(geoKeyModelType, modelTypeProjected, geoKeyProjectedCSType, 32635)},
+			CRSUnknown, GeoTransform{10, 0.5, 0, 50, 0, -0.25},
+		},
+		{
+			"model transformation",
+			[]tiffEntry{
+				{tagModelTransformation, []float64{0.5, 0, 0, 10, 0, -0.25, 0, 50, 0, 0, 0, 0, 0, 0, 0, 1}},
+				geoKeyDir(geoKeyModelType, modelTypeGeographic),
+			},
+			EPSG4326, GeoTransform{10, 0.5, 0, 50, 0, -0.25},
+		},
+	} {
+		r, err := DecodeGeoTIFF(buildTIFF(4, 2, 1, pix, tc.tags...))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if r.CRS != tc.crs || r.Transform != tc.transform {
+			t.Errorf("%s: CRS %v transform %v, want %v %v", tc.name, r.CRS, r.Transform, tc.crs, tc.transform)
+		}
+		if r.Image.Bounds().Size() != image.Pt(4, 2) || r.SampleBits != 8 || r.HasNoData {
+			t.Errorf("%s: image %v, %d bits, nodata %v", tc.name, r.Image.Bounds(), r.SampleBits, r.HasNoData)
+		}
+	}
+
+	r, err := DecodeGeoTIFF(buildTIFF(4, 2, 1, pix, tiepoint, scale, geoKeyDir(geoKeyModelType, modelTypeGeographic)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LatLngBounds{NorthWest: LatLng{Lat: 50, Lng: 10}, SouthEast: LatLng{Lat: 49.5, Lng: 12}}
+	if b := r.Bounds(); b != want {
+		t.Errorf("bounds %+v, want %+v", b, want)
+	}
+
+	if _, err := DecodeGeoTIFF(buildTIFF(4, 2, 1, pix)); err == nil {
+		t.Error("TIFF without georeference decoded")
+	}
+	if _, err := DecodeGeoTIFF([]byte("MM\x00\x2b\x00\x00\x00\x08")); err == nil {
+		t.Error("BigTIFF decoded")
+	}
+}
+
+func TestDecodeGeoTIFFNoData(t *testing.T) {
+	pix := []byte{
+		200, 200, 200, 255, 200, 200, 200, 128,
+		10, 20, 30, 128, 40, 50, 60, 255,
+	}
+	data := buildTIFF(2, 2, 4, pix,
+		tiffEntry{tagModelTiepoint, []float64{0, 0, 0, -180, 90, 0}},
+		tiffEntry{tagModelPixelScale, []float64{180, 90, 0}},
+		geoKeyDir(geoKeyModelType, modelTypeGeographic),
+		tiffEntry{tagGDALNoData, "200"},
+	)
+	r, err := DecodeGeoTIFF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.HasNoData || r.NoData != 200 {
+		t.Fatalf("nodata %v %v, want 200", r.HasNoData, r.NoData)
+	}
+	// Both gray pixels are nodata, whatever their alpha
+	for _, tc := range []struct {
+		x, y  int
+		valid bool
+	}{{0, 0, false}, {1, 0, false}, {0, 1, true}, {1, 1, true}} {
+		if _, valid := r.at(tc.x, tc.y); valid != tc.valid {
+			t.Errorf("pixel (%d,%d) valid %v, want %v", tc.x, tc.y, valid, tc.valid)
+		}
+	}
+}
+
+func TestRenderTile(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	colors := []color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}, {R: 255, G: 255, A: 255}}
+	for i, c := range colors {
+		img.SetNRGBA(i%2, i/2, c)
+	}
+	e := math.Pi * earthRadius
+	for _, r := range []*GeoRaster{
+		{Image: img, CRS: EPSG3857, Transform: GeoTransform{-e, e, 0, e, 0, -e}},
+		{Image: img, CRS: EPSG4326, Transform: GeoTransform{-180, 180, 0, 90, 0, -90}},
+	} {
+		tile, err := r.RenderTile(Tile{}, 4, SampleNearest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Each quadrant of the world tile is one pixel of the raster
+		for i, c := range colors {
+			for _, p := range []image.Point{{0, 0}, {1, 1}} {
+				x, y := i%2*2+p.X, i/2*2+p.Y
+				if got := tile.RGBAAt(x, y); got != color.RGBA(c) {
+					t.Errorf("CRS %v: pixel (%d,%d) is %v, want %v", r.CRS, x, y, got, c)
+				}
+			}
+		}
+	}
+
+	// A tile away from the raster
+	small := &GeoRaster{Image: img, CRS: EPSG4326, Transform: GeoTransform{10, 0.01, 0, 50, 0, -0.01}}
+	if _, err := small.RenderTile(Tile{X: 0, Y: 0, Zoom: 4}, 4, SampleNearest); err != ErrNoCoverage {
+		t.Errorf("error %v, want ErrNoCoverage", err)
+	}
+
+	// Nodata pixels stay transparent
+	nd := &GeoRaster{Image: img, CRS: EPSG3857, Transform: GeoTransform{-e, e, 0, e, 0, -e}, NoData: 255, HasNoData: true}
+	img.SetNRGBA(1, 1, color.NRGBA{R: 255, G: 255, B: 255, A: 200})
+	tile, err := nd.RenderTile(Tile{}, 4, SampleBilinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tile.RGBAAt(3, 3); got.A != 0 {
+		t.Errorf("nodata pixel drawn as %v", got)
+	}
+	if got := tile.RGBAAt(0, 0); got != color.RGBA(colors[0]) {
+		t.Errorf("pixel drawn as %v, want %v", got, colors[0])
+	}
+}
@@ -11,72 +11,307 @@ import (
 	"golang.org/x/image/math/fixed"
 )
 
-type LocalTileProvider struct{}
+// DebugStyle selects what LocalTileProvider draws on each tile
+type DebugStyle int
+
+const (
+	// StyleLabel draws a filled tile with its z/x/y label
+	StyleLabel DebugStyle = iota
+	// StyleCheckerboard alternates squares so seams and gaps stand out
+	StyleCheckerboard
+	// StyleGrid subdivides the tile with pixel-offset labeled grid lines
+	StyleGrid
+	// StyleBounds labels the tile with its north-west and south-east corners
+	StyleBounds
+	// StyleMetersPerPixel labels the tile with its ground resolution
+	StyleMetersPerPixel
+	// StyleError draws an error tile carrying Message
+	StyleError
+	// StyleOverlay draws only borders and the label on a transparent tile,
+	// on top of the Base provider's tile when one is set
+	StyleOverlay
+)
+
+func (s DebugStyle) String() string {
+	switch s {
+	case StyleLabel:
+		return "label"
+	case StyleCheckerboard:
+		return "checkerboard"
+	case StyleGrid:
+		return "grid"
+	case StyleBounds:
+		return "bounds"
+	case StyleMetersPerPixel:
+		return "meters-per-pixel"
+	case StyleError:
+		return "error"
+	case StyleOverlay:
+		return "overlay"
+	}
+	return fmt.Sprintf("DebugStyle(%d)", int(s))
+}
+
+// LocalTileOptions configures the tiles generated by LocalTileProvider
+type LocalTileOptions struct {
+	Style    DebugStyle
+	TileSize int // edge length in pixels, TileSize when zero
+
+	Background     color.RGBA
+	Alternate      color.RGBA // second checkerboard color and grid line color
+	Border         color.RGBA
+	Text           color.RGBA
+	TextBackground color.RGBA
+
+	// GridDivisions is the number of cells per tile edge for StyleCheckerboard
+	// and StyleGrid
+	GridDivisions int
+	// Message is drawn under the label by StyleError
+	Message string
+	// Base provides the tiles StyleOverlay draws on top of
+	Base TileProvider
+}
+
+// DefaultLocalTileOptions returns the options used by NewLocalTileProvider
+func DefaultLocalTileOptions() LocalTileOptions {
+	return LocalTileOptions{
+		Style:          StyleLabel,
+		TileSize:       TileSize,
+		Background:     color.RGBA{200, 220, 255, 255},
+		Alternate:      color.RGBA{160, 185, 230, 255},
+		Border:         color.RGBA{100, 100, 100, 255},
+		Text:           color.RGBA{40, 40, 40, 255},
+		TextBackground: color.RGBA{220, 220, 220, 220}, // premultiplied white,
+		GridDivisions:  8,
+	}
+}
+
+// ErrorTileOptions returns options for red StyleError tiles carrying message
+func ErrorTileOptions(message string) LocalTileOptions {
+	opts := DefaultLocalTileOptions()
+	opts.Style = StyleError
+	opts.Background = color.RGBA{255, 215, 215, 255}
+	opts.Border = color.RGBA{200, 40, 40, 255}
+	opts.Text = color.RGBA{160, 0, 0, 255}
+	opts.Message = message
+	return opts
+}
+
+// ErrorTile renders a StyleError tile showing err, for tiles that failed to
+// load
+func ErrorTile(tile Tile, err error) image.Image {
+	msg := "load failed"
+	if err != nil {
+		msg = err.Error()
+	}
+	// Keep to one line of the basic font
+	if limit := (TileSize - 16) / 7; len(msg) > limit {
+		msg = msg[:limit-3] + "..."
+	}
+	p := NewLocalTileProviderWithOptions(ErrorTileOptions(msg))
+	return p.render(tile)
+}
+
+// LocalTileProvider generates diagnostic tiles without any network access
+type LocalTileProvider struct {
+	opts  LocalTileOptions
+	cache *Cache[Tile, image.Image]
+}
 
 func NewLocalTileProvider() *LocalTileProvider {
-	return &LocalTileProvider{}
+	return NewLocalTileProviderWithOptions(DefaultLocalTileOptions())
+}
+
+func NewLocalTileProviderWithOptions(opts LocalTileOptions) *LocalTileProvider {
+	if opts.TileSize <= 0 {
+		opts.TileSize = TileSize
+	}
+	if opts.GridDivisions <= 0 {
+		opts.GridDivisions = 8
+	}
+	return &LocalTileProvider{
+		opts: opts,
+		cache: NewCache(CacheOptions[Tile, image.Image]{
+			Policy: NewLRUPolicy[Tile](DefaultCacheBudget),
+			Size:   ImageBytes,
+		}),
+	}
+}
+
+// Options returns the options the provider was created with
+func (p *LocalTileProvider) Options() LocalTileOptions {
+	return p.opts
 }
 
 func (p *LocalTileProvider) GetTile(tile Tile) (image.Image, error) {
-	// Create a new 256x256 RGBA image (standard tile size)
-	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	// Generated tiles never change, so draw each one only once
+	img, exists := p.cache.Get(tile)
+	if !exists {
+		img = p.render(tile)
+		p.cache.Set(tile, img)
+	}
 
-	// Fill with light blue background
-	bgColor := color.RGBA{200, 220, 255, 255}
-	draw.Draw(img, img.Bounds(), &image.Uniform{bgColor}, image.Point{}, draw.Src)
+	if p.opts.Style == StyleOverlay && p.opts.Base != nil {
+		return p.composeOverlay(tile, img)
+	}
+	return img, nil
+}
+
+// ClearCache drops all memoized tiles
+func (p *LocalTileProvider) ClearCache() {
+	p.cache.Clear()
+}
 
-	// Draw the tile text
-	drawText(img, tile)
+func (p *LocalTileProvider) render(tile Tile) *image.RGBA {
+	size := p.opts.TileSize
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	label := fmt.Sprintf("%d/%d/%d", tile.Zoom, tile.X, tile.Y)
+
+	switch p.opts.Style {
+	case StyleCheckerboard:
+		p.drawCheckerboard(img, tile)
+		drawText(img, p.opts, label)
+	case StyleGrid:
+		fill(img, img.Bounds(), p.opts.Background)
+		p.drawGrid(img)
+		drawText(img, p.opts, label)
+	case StyleBounds:
+		fill(img, img.Bounds(), p.opts.Background)
+		nw, se := TileBounds(tile)
+		drawText(img, p.opts,
+			label,
+			fmt.Sprintf("NW %.5f, %.5f", nw.Lat, nw.Lng),
+			fmt.Sprintf("SE %.5f, %.5f", se.Lat, se.Lng),
+		)
+	case StyleMetersPerPixel:
+		fill(img, img.Bounds(), p.opts.Background)
+		center := TileCenter(tile)
+		mpp := CalculateMetersPerPixel(center.Lat, tile.Zoom) * TileSize / float64(size)
+		drawText(img, p.opts,
+			label,
+			fmt.Sprintf("%.3f m/px", mpp),
+			fmt.Sprintf("lat %.5f", center.Lat),
+		)
+	case StyleError:
+		fill(img, img.Bounds(), p.opts.Background)
+		drawText(img, p.opts, label, p.opts.Message)
+	case StyleOverlay:
+		// Leave the background transparent
+		drawText(img, p.opts, label)
+	default:
+		fill(img, img.Bounds(), p.opts.Background)
+		drawText(img, p.opts, label)
+	}
 
 	// Draw a border around the tile
-	borderColor := color.RGBA{100, 100, 100, 255}
 	borders := []image.Rectangle{
-		image.Rect(0, 0, 256, 1),     // Top
-		image.Rect(0, 255, 256, 256), // Bottom
-		image.Rect(0, 0, 1, 256),     // Left
-		image.Rect(255, 0, 256, 256), // Right
+		image.Rect(0, 0, size, 1),         // Top
+		image.Rect(0, size-1, size, size), // Bottom
+		image.Rect(0, 0, 1, size),         // Left
+		image.Rect(size-1, 0, size, size), // Right
 	}
 	for _, rect := range borders {
-		draw.Draw(img, rect, &image.Uniform{borderColor}, image.Point{}, draw.Src)
+		fill(img, rect, p.opts.Border)
 	}
 
+	return img
+}
+
+func (p *LocalTileProvider) composeOverlay(tile Tile, overlay image.Image) (image.Image, error) {
+	base, err := p.opts.Base.GetTile(tile)
+	if err != nil {
+		return overlay, nil
+	}
+	size := p.opts.TileSize
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), base, base.Bounds().Min, draw.Src)
+	draw.Draw(img, img.Bounds(), overlay, image.Point{}, draw.Over)
 	return img, nil
 }
 
-func drawText(img *image.RGBA, tile Tile) {
-	// Create the text to draw
-	text := fmt.Sprintf("%d/%d/%d", tile.Zoom, tile.X, tile.Y)
+func (p *LocalTileProvider) drawCheckerboard(img *image.RGBA, tile Tile) {
+	size := p.opts.TileSize
+	n := p.opts.GridDivisions
+	// Flip the pattern on odd tiles so that neighbouring tiles never line up
+	// seamlessly, which makes a one-tile offset immediately visible
+	parity := (tile.X + tile.Y) & 1
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			c := p.opts.Background
+			if (row+col+parity)&1 == 1 {
+				c = p.opts.Alternate
+			}
+			fill(img, image.Rect(col*size/n, row*size/n, (col+1)*size/n, (row+1)*size/n), c)
+		}
+	}
+}
+
+func (p *LocalTileProvider) drawGrid(img *image.RGBA) {
+	size := p.opts.TileSize
+	n := p.opts.GridDivisions
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(p.opts.Border),
+		Face: basicfont.Face7x13,
+	}
+	for i := 1; i < n; i++ {
+		pos := i * size / n
+		fill(img, image.Rect(pos, 0, pos+1, size), p.opts.Alternate)
+		fill(img, image.Rect(0, pos, size, pos+1), p.opts.Alternate)
+		// Label every other line with its pixel offset
+		if i%2 == 0 {
+			d.Dot = fixed.P(pos+2, 12)
+			d.DrawString(fmt.Sprint(pos))
+			d.Dot = fixed.P(2, pos-2)
+			d.DrawString(fmt.Sprint(pos))
+		}
+	}
+}
+
+func fill(img *image.RGBA, rect image.Rectangle, c color.RGBA) {
+	draw.Draw(img, rect, &image.Uniform{c}, image.Point{}, draw.Src)
+}
 
+// drawText draws the lines centered on the tile over a shared background box
+func drawText(img *image.RGBA, opts LocalTileOptions, lines ...string) {
 	// Use a font drawer to measure text dimensions
 	face := basicfont.Face7x13
 	d := &font.Drawer{
 		Dst:  img,
-		Src:  image.NewUniform(color.White),
+		Src:  image.NewUniform(opts.Text),
 		Face: face,
 	}
 
 	// Measure text dimensions
-	textWidth := d.MeasureString(text).Round()
-	textHeight := face.Metrics().Height.Round()
+	textWidth := 0
+	for _, line := range lines {
+		textWidth = max(textWidth, d.MeasureString(line).Round())
+	}
+	lineHeight := face.Metrics().Height.Round()
+	textHeight := lineHeight * len(lines)
 
 	// Calculate background rectangle for the text
+	size := img.Bounds().Dx()
 	padding := 10
+	top := size/2 - 8 - textHeight/2
 	textBgRect := image.Rect(
-		(256-textWidth)/2-padding,
-		120-textHeight/2-padding,
-		(256+textWidth)/2+padding,
-		120+textHeight/2+padding,
+		(size-textWidth)/2-padding,
+		top-padding,
+		(size+textWidth)/2+padding,
+		top+textHeight+padding,
 	)
 	// Draw text background
-	textBgColor := color.RGBA{255, 255, 255, 220}
-	draw.Draw(img, textBgRect, &image.Uniform{textBgColor}, image.Point{}, draw.Over)
+	draw.Draw(img, textBgRect, &image.Uniform{opts.TextBackground}, image.Point{}, draw.Over)
 
-	// Set up the position for the text
-	d.Dot = fixed.Point26_6{
-		X: fixed.I((256 - textWidth) / 2),
-		Y: fixed.I(120 + textHeight/2),
-	}
+	for i, line := range lines {
+		// Set up the position for the line
+		w := d.MeasureString(line).Round()
+		d.Dot = fixed.Point26_6{
+			X: fixed.I((size - w) / 2),
+			Y: fixed.I(top + (i+1)*lineHeight - 3),
+		}
 
-	// Draw the text
-	d.DrawString(text)
+		// Draw the text
+		d.DrawString(line)
+	}
 }
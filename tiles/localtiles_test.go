@@ -0,0 +1,75 @@
+package tiles
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// solidProvider returns tiles of a single color
+type solidProvider color.RGBA
+
+func (p solidProvider) GetTile(tile Tile) (image.Image, error) {
+	img := image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
+	fill(img, img.Bounds(), color.RGBA(p))
+	return img, nil
+}
+
+func TestLocalTileSize(t *testing.T) {
+	for _, style := range []DebugStyle{StyleLabel, StyleCheckerboard, StyleGrid, StyleBounds, StyleMetersPerPixel, StyleError, StyleOverlay} {
+		opts := DefaultLocalTileOptions()
+		opts.Style = style
+		opts.TileSize = 512
+		img, err := NewLocalTileProviderWithOptions(opts).GetTile(Tile{X: 3, Y: 5, Zoom: 4})
+		if err != nil {
+			t.Fatalf("%v: %v", style, err)
+		}
+		if size := img.Bounds().Size(); size != image.Pt(512, 512) {
+			t.Errorf("%v: tile is %v, want 512x512", style, size)
+		}
+		// The border runs along the far edges too
+		if got := color.RGBAModel.Convert(img.At(511, 300)); got != opts.Border {
+			t.Errorf("%v: right edge is %v, want the border", style, got)
+		}
+	}
+}
+
+func TestLocalTileOverlay(t *testing.T) {
+	opts := DefaultLocalTileOptions()
+	opts.Style = StyleOverlay
+	tile := Tile{X: 1, Y: 1, Zoom: 2}
+	img, err := NewLocalTileProviderWithOptions(opts).GetTile(tile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(20, 20).RGBA(); a != 0 {
+		t.Errorf("interior pixel has alpha %d, want transparent", a)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 20)); got != opts.Border {
+		t.Errorf("border is %v, want %v", got, opts.Border)
+	}
+
+	// Over a base tile the interior shows the base
+	base := color.RGBA{R: 10, G: 120, B: 30, A: 255}
+	opts.Base = solidProvider(base)
+	img, err = NewLocalTileProviderWithOptions(opts).GetTile(tile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.RGBAModel.Convert(img.At(20, 20)); got != base {
+		t.Errorf("interior is %v, want the base %v", got, base)
+	}
+}
+
+func TestLocalTileMemoized(t *testing.T) {
+	p := NewLocalTileProvider()
+	tile := Tile{X: 2, Y: 1, Zoom: 3}
+	first, _ := p.GetTile(tile)
+	if again, _ := p.GetTile(tile); again != first {
+		t.Error("tile drawn again")
+	}
+	p.ClearCache()
+	if again, _ := p.GetTile(tile); again == first {
+		t.Error("ClearCache kept the tile")
+	}
+}
@@ -0,0 +1,14 @@
+package tiles
+
+import "github.com/olablt/gio-tiles/tiles/metrics"
+
+// Metrics of the tile pipeline, published through the metrics package
+var (
+	cacheHits       = metrics.Default.Counter("gio_tiles_cache_hits_total", "Tile cache hits by cache.", "cache")
+	cacheMisses     = metrics.Default.Counter("gio_tiles_cache_misses_total", "Tile cache misses by cache.", "cache")
+	cacheEvictions  = metrics.Default.Counter("gio_tiles_cache_evictions_total", "Entries evicted from tile caches.", "cache")
+	cacheBytes      = metrics.Default.Gauge("gio_tiles_cache_bytes", "Bytes held by tile caches.", "cache")
+	fetchesInFlight = metrics.Default.Gauge("gio_tiles_fetches_in_flight", "Tile downloads in progress.", "provider")
+	fetchDuration   = metrics.Default.Histogram("gio_tiles_fetch_duration_seconds", "Tile download latency.", metrics.DefaultLatencyBuckets, "provider")
+	httpResponses   = metrics.Default.Counter("gio_tiles_http_responses_total", "Tile server responses by status code, \"error\" for failed requests.", "provider", "code")
+)
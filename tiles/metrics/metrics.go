@@ -0,0 +1,325 @@
+// Package metrics implements the counters, gauges and histograms of the
+// tile pipeline. Metrics of the Default registry are published through
+// expvar under "gio_tiles", and Handler serves them in the Prometheus text
+// exposition format.
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Default is the registry used by the tiles packages
+var Default = NewRegistry()
+
+func init() {
+	expvar.Publish("gio_tiles", expvar.Func(func() any { return Default.Snapshot() }))
+}
+
+// DefaultLatencyBuckets are histogram bucket bounds in seconds suited to
+// tile fetches
+var DefaultLatencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type kind string
+
+const (
+	kindCounter   kind = "counter"
+	kindGauge     kind = "gauge"
+	kindHistogram kind = "histogram"
+)
+
+// Registry holds a set of uniquely named metrics
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]*metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*metric)}
+}
+
+// metric is a family of series sharing a name and label names
+type metric struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+	fn      func() float64
+
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  atomic.Uint64 // float64 bits
+	counts []atomic.Uint64
+	count  atomic.Uint64
+}
+
+func (r *Registry) register(m *metric) *metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.metrics[m.name]; ok {
+		if existing.kind != m.kind {
+			panic(fmt.Sprintf("metrics: %s registered as %s and %s", m.name, existing.kind, m.kind))
+		}
+		return existing
+	}
+	m.series = make(map[string]*series)
+	r.metrics[m.name] = m
+	return m
+}
+
+func (m *metric) get(values []string) *series {
+	if s, ok := m.find(values); ok {
+		return s
+	}
+
+	key := strings.Join(values, "\xff")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.series[key]; ok {
+		return s
+	}
+	s := &series{labels: append([]string(nil), values...)}
+	if m.kind == kindHistogram {
+		s.counts = make([]atomic.Uint64, len(m.buckets))
+	}
+	m.series[key] = s
+	return s
+}
+
+// find returns the series of the label values without creating it
+func (m *metric) find(values []string) (*series, bool) {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", m.name, len(m.labels), len(values)))
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.series[strings.Join(values, "\xff")]
+	return s, ok
+}
+
+// value returns the value of a series, 0 for one never written
+func (m *metric) value(values []string) float64 {
+	if s, ok := m.find(values); ok {
+		return s.load()
+	}
+	return 0
+}
+
+func (s *series) add(v float64) {
+	for {
+		old := s.value.Load()
+		if s.value.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (s *series) load() float64 {
+	return math.Float64frombits(s.value.Load())
+}
+
+// Counter is a monotonically increasing value per label combination
+type Counter struct{ m *metric }
+
+// Counter registers a counter, or returns the one already registered
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(&metric{name: name, help: help, kind: kindCounter, labels: labels})}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.m.get(labelValues).add(1)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.m.get(labelValues).add(v)
+}
+
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.m.value(labelValues)
+}
+
+// Gauge is a value that can go up and down per label combination
+type Gauge struct{ m *metric }
+
+// Gauge registers a gauge, or returns the one already registered
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(&metric{name: name, help: help, kind: kindGauge, labels: labels})}
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.get(labelValues).value.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.get(labelValues).add(v)
+}
+
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.m.value(labelValues)
+}
+
+// GaugeFunc registers an unlabeled gauge whose value is computed by fn
+// when the metrics are read
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(&metric{name: name, help: help, kind: kindGauge, fn: fn})
+}
+
+// Histogram counts observations in cumulative buckets per label
+// combination
+type Histogram struct{ m *metric }
+
+// Histogram registers a histogram with the given upper bucket bounds, or
+// returns the one already registered
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.register(&metric{name: name, help: help, kind: kindHistogram, labels: labels, buckets: buckets})}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	s := h.m.get(labelValues)
+	for i, bound := range h.m.buckets {
+		if v <= bound {
+			s.counts[i].Add(1)
+		}
+	}
+	s.count.Add(1)
+	s.add(v)
+}
+
+// Count returns the number of observations, 0 for a series never observed
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	if s, ok := h.m.find(labelValues); ok {
+		return s.count.Load()
+	}
+	return 0
+}
+
+// sorted returns the metrics ordered by name and their series ordered by
+// label values
+func (r *Registry) sorted() []*metric {
+	r.mu.Lock()
+	metrics := make([]*metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	return metrics
+}
+
+func (m *metric) sortedSeries() []*series {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]*series, len(keys))
+	for i, key := range keys {
+		out[i] = m.series[key]
+	}
+	m.mu.RUnlock()
+	return out
+}
+
+// WritePrometheus writes all metrics in the Prometheus text format
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	var b strings.Builder
+	for _, m := range r.sorted() {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		if m.fn != nil {
+			fmt.Fprintf(&b, "%s %s\n", m.name, formatFloat(m.fn()))
+			continue
+		}
+		for _, s := range m.sortedSeries() {
+			if m.kind != kindHistogram {
+				fmt.Fprintf(&b, "%s%s %s\n", m.name, m.labelString(s.labels, ""), formatFloat(s.load()))
+				continue
+			}
+			for i, bound := range m.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, m.labelString(s.labels, formatFloat(bound)), s.counts[i].Load())
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, m.labelString(s.labels, "+Inf"), s.count.Load())
+			fmt.Fprintf(&b, "%s_sum%s %s\n", m.name, m.labelString(s.labels, ""), formatFloat(s.load()))
+			fmt.Fprintf(&b, "%s_count%s %d\n", m.name, m.labelString(s.labels, ""), s.count.Load())
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (m *metric) labelString(values []string, le string) string {
+	var pairs []string
+	for i, name := range m.labels {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes label values as the text format defines, which
+// unlike Go quoting leaves other characters such as non-ASCII ones as is
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Snapshot returns the current values keyed by metric name, then by
+// comma separated label values for labeled metrics
+func (r *Registry) Snapshot() map[string]any {
+	out := make(map[string]any)
+	for _, m := range r.sorted() {
+		if m.fn != nil {
+			out[m.name] = m.fn()
+			continue
+		}
+		values := make(map[string]any)
+		for _, s := range m.sortedSeries() {
+			key := strings.Join(s.labels, ",")
+			if m.kind == kindHistogram {
+				values[key] = map[string]any{"count": s.count.Load(), "sum": s.load()}
+			} else {
+				values[key] = s.load()
+			}
+		}
+		if len(m.labels) == 0 {
+			out[m.name] = values[""]
+		} else {
+			out[m.name] = values
+		}
+	}
+	return out
+}
+
+// Handler serves the registry in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// Handler serves the Default registry in the Prometheus text format
+func Handler() http.Handler {
+	return Default.Handler()
+}
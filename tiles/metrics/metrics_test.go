@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	hits := r.Counter("hits_total", "Cache hits.", "cache")
+	depth := r.Gauge("queue_depth", "Queued tasks.")
+	latency := r.Histogram("fetch_seconds", "Fetch latency.", []float64{0.1, 1}, "provider")
+	r.GaugeFunc("workers", "Worker count.", func() float64 { return 4 })
+
+	hits.Inc("memory")
+	hits.Add(2, "memory")
+	hits.Inc("disk")
+	depth.Add(3)
+	depth.Add(-1)
+	latency.Observe(0.05, "osm")
+	latency.Observe(0.5, "osm")
+	latency.Observe(5, "osm")
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP fetch_seconds Fetch latency.
+# TYPE fetch_seconds histogram
+fetch_seconds_bucket{provider="osm",le="0.1"} 1
+fetch_seconds_bucket{provider="osm",le="1"} 2
+fetch_seconds_bucket{provider="osm",le="+Inf"} 3
+fetch_seconds_sum{provider="osm"} 5.55
+fetch_seconds_count{provider="osm"} 3
+# HELP hits_total Cache hits.
+# TYPE hits_total counter
+hits_total{cache="disk"} 1
+hits_total{cache="memory"} 3
+# HELP queue_depth Queued tasks.
+# TYPE queue_depth gauge
+queue_depth 2
+# HELP workers Worker count.
+# TYPE workers gauge
+workers 4
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("codes_total", "Responses.", "provider", "code").Inc("osm", "429")
+	r.Gauge("bytes", "Bytes.").Set(42)
+
+	snap := r.Snapshot()
+	if v := snap["bytes"]; v != 42.0 {
+		t.Errorf("bytes = %v, want 42", v)
+	}
+	codes := snap["codes_total"].(map[string]any)
+	if v := codes["osm,429"]; v != 1.0 {
+		t.Errorf("codes_total[osm,429] = %v, want 1", v)
+	}
+}
+
+func TestValueDoesNotCreateSeries(t *testing.T) {
+	r := NewRegistry()
+	hits := r.Counter("hits_total", "Cache hits.", "cache")
+	depth := r.Gauge("queue_depth", "Queued tasks.", "queue")
+	latency := r.Histogram("fetch_seconds", "Fetch latency.", DefaultLatencyBuckets, "host")
+	if hits.Value("memory") != 0 || depth.Value("fetch") != 0 || latency.Count("osm") != 0 {
+		t.Error("unwritten series are not 0")
+	}
+	var b strings.Builder
+	r.WritePrometheus(&b)
+	if strings.Contains(b.String(), "memory") || strings.Contains(b.String(), "fetch\"") || strings.Contains(b.String(), "osm") {
+		t.Errorf("reading created series:\n%s", b.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("tiles_total", "Tiles.", "provider").Inc("Straße \"A\"\\b\nc")
+	var b strings.Builder
+	r.WritePrometheus(&b)
+	want := `tiles_total{provider="Straße \"A\"\\b\nc"} 1`
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("got:\n%s\nwant the line %s", b.String(), want)
+	}
+}
@@ -5,27 +5,88 @@ import (
 	"fmt"
 	"image"
 	_ "image/png"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// DefaultOSMBaseURL is the tile server used by NewOSMTileProvider
+const DefaultOSMBaseURL = "https://tile.openstreetmap.org"
+
+// OSMTileProviderOptions configures OSMTileProvider
+type OSMTileProviderOptions struct {
+	// BaseURL is prepended to /{z}/{x}/{y}.png, DefaultOSMBaseURL when empty
+	BaseURL string
+	// Client performs the requests, a new http.Client when nil
+	Client *http.Client
+}
+
 type OSMTileProvider struct {
 	progressMutex sync.Mutex
 	progress      map[string]int
 	client        *http.Client
+	baseURL       string
+	host          string
 }
 
 func NewOSMTileProvider() *OSMTileProvider {
+	return NewOSMTileProviderWithOptions(OSMTileProviderOptions{})
+}
+
+func NewOSMTileProviderWithOptions(opts OSMTileProviderOptions) *OSMTileProvider {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultOSMBaseURL
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+	host := opts.BaseURL
+	if u, err := url.Parse(opts.BaseURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
 	return &OSMTileProvider{
 		progressMutex: sync.Mutex{},
 		progress:      map[string]int{},
-		client:        &http.Client{},
+		client:        opts.Client,
+		baseURL:       strings.TrimSuffix(opts.BaseURL, "/"),
+		host:          host,
 	}
 }
 
 func (p *OSMTileProvider) GetTile(tile Tile) (image.Image, error) {
+	return p.GetTileContext(context.Background(), tile)
+}
+
+// GetTileContext is GetTile with a context that cancels the download
+func (p *OSMTileProvider) GetTileContext(ctx context.Context, tile Tile) (image.Image, error) {
+	data, err := p.GetTileDataContext(ctx, tile)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := DecodeTile(data)
+	if err != nil {
+		log.Printf("Error decoding tile image %v: %v", tile, err)
+		return nil, err
+	}
+
+	log.Printf("OSM: Successfully loaded tile z=%d x=%d y=%d", tile.Zoom, tile.X, tile.Y)
+	return img, nil
+}
+
+// GetTileData downloads the encoded tile without decoding it
+func (p *OSMTileProvider) GetTileData(tile Tile) ([]byte, error) {
+	return p.GetTileDataContext(context.Background(), tile)
+}
+
+// GetTileDataContext is GetTileData with a context that cancels the
+// download
+func (p *OSMTileProvider) GetTileDataContext(ctx context.Context, tile Tile) ([]byte, error) {
 	url := p.GetTileURL(tile)
 
 	p.progressMutex.Lock()
@@ -40,7 +101,7 @@ func (p *OSMTileProvider) GetTile(tile Tile) (image.Image, error) {
 	p.progressMutex.Unlock()
 
 	// Create request with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer func() {
 		p.progressMutex.Lock()
 		delete(p.progress, url)
@@ -61,30 +122,40 @@ func (p *OSMTileProvider) GetTile(tile Tile) (image.Image, error) {
 	req.Header.Set("Connection", "keep-alive")
 	req.Header.Set("Referer", "https://www.openstreetmap.org/")
 
+	start := time.Now()
+	fetchesInFlight.Add(1, p.host)
+	defer fetchesInFlight.Add(-1, p.host)
+
 	resp, err := p.client.Do(req)
 	if err != nil {
+		httpResponses.Inc(p.host, "error")
 		log.Printf("Error fetching tile %v: %v", tile, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	httpResponses.Inc(p.host, strconv.Itoa(resp.StatusCode))
 
 	// log.Printf("OSM tile response status: %s", resp.Status)
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	img, _, err := image.Decode(resp.Body)
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Error decoding tile image %v: %v", tile, err)
+		log.Printf("Error reading tile %v: %v", tile, err)
 		return nil, err
 	}
+	fetchDuration.Observe(time.Since(start).Seconds(), p.host)
+	return data, nil
+}
 
-	log.Printf("OSM: Successfully loaded tile z=%d x=%d y=%d", tile.Zoom, tile.X, tile.Y)
-	return img, nil
+// Host returns the tile server host, which labels the provider's metrics
+func (p *OSMTileProvider) Host() string {
+	return p.host
 }
 
 // GetTileURL returns the URL for downloading the map tile
 func (p *OSMTileProvider) GetTileURL(tile Tile) string {
-	return fmt.Sprintf("https://tile.openstreetmap.org/%d/%d/%d.png",
-		tile.Zoom, tile.X, tile.Y)
+	return fmt.Sprintf("%s/%d/%d/%d.png",
+		p.baseURL, tile.Zoom, tile.X, tile.Y)
 }
@@ -0,0 +1,71 @@
+package tiles
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/olablt/gio-tiles/tiles/tiletest"
+)
+
+func TestOSMTileProviderGetTile(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	p := NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL})
+
+	img, err := p.GetTile(Tile{X: 3, Y: 5, Zoom: 4})
+	if err != nil {
+		t.Fatalf("GetTile: %v", err)
+	}
+	r, g, b, _ := img.At(10, 10).RGBA()
+	want := tiletest.TileColor(4, 3, 5)
+	if uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B {
+		t.Errorf("got color %d,%d,%d, want %v", r>>8, g>>8, b>>8, want)
+	}
+	if n := srv.Requests(4, 3, 5); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestOSMTileProviderFaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior tiletest.Behavior
+	}{
+		{"server error", tiletest.Behavior{StatusCode: http.StatusInternalServerError}},
+		{"not found", tiletest.Behavior{StatusCode: http.StatusNotFound}},
+		{"rate limited", tiletest.RateLimited(30)},
+		{"truncated body", tiletest.Behavior{Truncate: true}},
+		{"invalid image", tiletest.Behavior{InvalidImage: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tiletest.NewServer()
+			defer srv.Close()
+			srv.SetDefault(tt.behavior)
+			p := NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL})
+
+			if _, err := p.GetTile(Tile{X: 1, Y: 1, Zoom: 2}); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestOSMTileProviderClientTimeout(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	srv.SetDefault(tiletest.Behavior{Latency: time.Second})
+	p := NewOSMTileProviderWithOptions(OSMTileProviderOptions{
+		BaseURL: srv.URL,
+		Client:  &http.Client{Timeout: 50 * time.Millisecond},
+	})
+
+	start := time.Now()
+	if _, err := p.GetTile(Tile{X: 0, Y: 0, Zoom: 0}); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("request took %v, client timeout was ignored", elapsed)
+	}
+}
@@ -0,0 +1,105 @@
+package tiles
+
+import (
+	"image"
+	"math"
+)
+
+// Viewport is the part of the map a view shows and how it is moving, the
+// input of prefetch planning
+type Viewport struct {
+	Center LatLng
+	// Zoom is the fractional zoom level of the view
+	Zoom float64
+	// Size is the view size in pixels
+	Size image.Point
+	// Velocity is how fast the view center moves, in pixels per second
+	Velocity image.Point
+	// ZoomDirection is positive while zooming in, negative while zooming
+	// out and zero otherwise
+	ZoomDirection int
+	// Anchor is the point kept in place by the zoom, usually the cursor
+	Anchor LatLng
+}
+
+// PrefetchOptions configures the prefetching of a TileManager
+type PrefetchOptions struct {
+	// Ring is the most tile rows ahead of a pan that are prefetched, 2 when
+	// zero
+	Ring int
+	// Lookahead is the pan duration in seconds to prefetch for, the ring
+	// grows with the pan speed up to Ring. 1 when zero.
+	Lookahead float64
+	// Budget bounds the prefetch loads queued or running at once, so that
+	// they never hold many workers, 8 when zero
+	Budget int
+	// MaxZoom is the deepest zoom level prefetched when zooming in, 19 when
+	// zero
+	MaxZoom int
+	// Disabled turns prefetching off
+	Disabled bool
+}
+
+func (o PrefetchOptions) withDefaults() PrefetchOptions {
+	if o.Ring <= 0 {
+		o.Ring = 2
+	}
+	if o.Lookahead <= 0 {
+		o.Lookahead = 1
+	}
+	if o.Budget <= 0 {
+		o.Budget = 8
+	}
+	if o.MaxZoom <= 0 {
+		o.MaxZoom = 19
+	}
+	return o
+}
+
+// PlanPrefetch returns the tiles worth loading before they are visible, most
+// useful first. These are the rows ahead of a pan, the next zoom level
+// around the anchor while zooming in and the previous level while zooming
+// out. Tiles visible in v are left out.
+func PlanPrefetch(v Viewport, opts PrefetchOptions) []Tile {
+	opts = opts.withDefaults()
+	zoom := int(math.Round(v.Zoom))
+	seen := make(map[Tile]bool)
+	for _, tile := range CalculateVisibleTiles(v.Center, zoom, v.Size) {
+		seen[tile] = true
+	}
+	var plan []Tile
+	add := func(tiles []Tile) {
+		for _, tile := range tiles {
+			if !seen[tile] {
+				seen[tile] = true
+				plan = append(plan, tile)
+			}
+		}
+	}
+
+	cx, cy := CalculateWorldCoordinates(v.Center, float64(zoom))
+	if v.Velocity != (image.Point{}) {
+		vx, vy := float64(v.Velocity.X), float64(v.Velocity.Y)
+		speed := math.Hypot(vx, vy)
+		rows := int(math.Ceil(speed * opts.Lookahead / TileSize))
+		rows = max(1, min(rows, opts.Ring))
+		// Shift the view a tile at a time along the pan, nearest rows first
+		for step := 1; step <= rows; step++ {
+			d := float64(step) * TileSize / speed
+			center := WorldToLatLng(cx+vx*d, cy+vy*d, float64(zoom))
+			add(CalculateVisibleTiles(center, zoom, v.Size))
+		}
+	}
+
+	ax, ay := CalculateWorldCoordinates(v.Anchor, float64(zoom))
+	switch {
+	case v.ZoomDirection > 0 && zoom < opts.MaxZoom:
+		// One level deeper the anchor keeps its screen position
+		center := WorldToLatLng(ax+cx, ay+cy, float64(zoom+1))
+		add(CalculateVisibleTiles(center, zoom+1, v.Size))
+	case v.ZoomDirection < 0 && zoom > 0:
+		center := WorldToLatLng(cx-ax/2, cy-ay/2, float64(zoom-1))
+		add(CalculateVisibleTiles(center, zoom-1, v.Size))
+	}
+	return plan
+}
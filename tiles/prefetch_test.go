@@ -0,0 +1,105 @@
+package tiles
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/olablt/gio-tiles/tiles/tiletest"
+)
+
+func TestPlanPrefetchPan(t *testing.T) {
+	v := Viewport{
+		Center:   LatLng{Lat: 51.5, Lng: -0.12},
+		Zoom:     12,
+		Size:     image.Pt(800, 600),
+		Velocity: image.Pt(600, 0), // moving east
+	}
+	visible := CalculateVisibleTiles(v.Center, 12, v.Size)
+	maxX := 0
+	for _, tile := range visible {
+		maxX = max(maxX, tile.X)
+	}
+
+	plan := PlanPrefetch(v, PrefetchOptions{Ring: 2})
+	if len(plan) == 0 {
+		t.Fatal("nothing planned for a pan")
+	}
+	for _, tile := range plan {
+		if tile.Zoom != 12 || tile.X <= maxX || tile.X > maxX+2 {
+			t.Errorf("planned %v, want zoom 12 tiles in the two columns east of x=%d", tile, maxX)
+		}
+	}
+	if plan[0].X != maxX+1 {
+		t.Errorf("first planned tile %v is not in the nearest column", plan[0])
+	}
+
+	if plan := PlanPrefetch(Viewport{Center: v.Center, Zoom: 12, Size: v.Size}, PrefetchOptions{}); len(plan) != 0 {
+		t.Errorf("planned %d tiles for a still view", len(plan))
+	}
+}
+
+func TestPlanPrefetchZoom(t *testing.T) {
+	v := Viewport{
+		Center: LatLng{Lat: 51.5, Lng: -0.12},
+		Zoom:   12,
+		Size:   image.Pt(512, 512),
+		Anchor: LatLng{Lat: 51.52, Lng: -0.05},
+	}
+
+	v.ZoomDirection = 1
+	anchor := LatLngToTile(v.Anchor, 13)
+	found := false
+	for _, tile := range PlanPrefetch(v, PrefetchOptions{}) {
+		if tile.Zoom != 13 {
+			t.Fatalf("planned %v while zooming in from 12", tile)
+		}
+		found = found || tile == anchor
+	}
+	if !found {
+		t.Errorf("tile %v under the anchor not planned", anchor)
+	}
+
+	v.ZoomDirection = -1
+	plan := PlanPrefetch(v, PrefetchOptions{})
+	if len(plan) == 0 || plan[0].Zoom != 11 {
+		t.Errorf("zooming out planned %v, want zoom 11 tiles", plan)
+	}
+}
+
+func TestTileManagerPrefetchBudget(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	srv.SetDefault(tiletest.Behavior{Latency: 200 * time.Millisecond})
+	tm := NewTileManagerWithOptions(
+		NewCombinedTileProvider(
+			NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+			NewLocalTileProvider(),
+		),
+		TileManagerOptions{Prefetch: PrefetchOptions{Budget: 3}},
+	)
+	defer tm.Close()
+
+	v := Viewport{Center: LatLng{Lat: 10, Lng: 10}, Zoom: 8, Size: image.Pt(512, 512), Velocity: image.Pt(0, 500)}
+	tm.Prefetch(v)
+	plan := PlanPrefetch(v, tm.prefetch)
+	queued := 0
+	for _, tile := range plan {
+		if tm.State(tile).State != StateAbsent {
+			queued++
+		}
+	}
+	if queued != 3 {
+		t.Errorf("%d prefetch loads in flight, budget is 3", queued)
+	}
+
+	// Turning around cancels the loads ahead of the old direction
+	v.Velocity = image.Pt(0, -500)
+	tm.Prefetch(v)
+	time.Sleep(50 * time.Millisecond)
+	for _, tile := range plan[:3] {
+		if st := tm.State(tile).State; st != StateAbsent {
+			t.Errorf("tile %v of the old plan is %v", tile, st)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package tiles
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TileWriter stores the encoded tiles of a pyramid
+type TileWriter interface {
+	WriteTile(tile Tile, data []byte) error
+	Close() error
+}
+
+// PyramidOptions configures GeneratePyramid
+type PyramidOptions struct {
+	MinZoom, MaxZoom int
+	TileSize         int // edge length in pixels, TileSize when zero
+	Sampling         Sampling
+	// Format is "png", "jpeg" or "jpg", png when empty. JPEG tiles have
+	// no transparency, so areas outside the image are black.
+	Format      string
+	JPEGQuality int
+}
+
+// ReadWorldFile parses an ESRI world file (.pgw, .jgw, .wld) into a
+// GeoTransform. World files reference pixel centers, the transform refers
+// to pixel corners.
+func ReadWorldFile(path string) (GeoTransform, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return GeoTransform{}, err
+	}
+	defer f.Close()
+
+	var v []float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return GeoTransform{}, fmt.Errorf("world file %s: %v", path, err)
+		}
+		v = append(v, n)
+	}
+	if err := scanner.Err(); err != nil {
+		return GeoTransform{}, err
+	}
+	if len(v) != 6 {
+		return GeoTransform{}, fmt.Errorf("world file %s: expected 6 values, got %d", path, len(v))
+	}
+
+	// Lines are A (x size), D (row rotation), B (column rotation),
+	// E (y size), C and F (center of the upper-left pixel)
+	a, d, b, e, c, f2 := v[0], v[1], v[2], v[3], v[4], v[5]
+	return GeoTransform{c - a/2 - b/2, a, b, f2 - d/2 - e/2, d, e}, nil
+}
+
+// FindWorldFile returns the world file next to an image, trying the
+// .pgw/.jgw style short extension, the "w" suffixed one and .wld
+func FindWorldFile(imagePath string) (string, bool) {
+	ext := filepath.Ext(imagePath)
+	base := strings.TrimSuffix(imagePath, ext)
+	var candidates []string
+	if len(ext) == 4 {
+		candidates = append(candidates, base+ext[:2]+ext[3:]+"w")
+	}
+	candidates = append(candidates, imagePath+"w", base+".wld")
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// TransformFromBounds returns the EPSG:4326 transform that stretches an
+// image of the given size over bounds
+func TransformFromBounds(bounds LatLngBounds, width, height int) GeoTransform {
+	nw, se := bounds.NorthWest, bounds.SouthEast
+	return GeoTransform{
+		nw.Lng, (se.Lng - nw.Lng) / float64(width), 0,
+		nw.Lat, 0, (se.Lat - nw.Lat) / float64(height),
+	}
+}
+
+// GeneratePyramid cuts the raster into tiles for every zoom level in
+// opts and hands them to w. The highest zoom is resampled from the raster
+// and each lower zoom is downsampled from its four children. Tiles without
+// any raster data are skipped. It returns the number of tiles written.
+func GeneratePyramid(raster *GeoRaster, w TileWriter, opts PyramidOptions) (int, error) {
+	if opts.TileSize <= 0 {
+		opts.TileSize = TileSize
+	}
+	if opts.MinZoom < 0 || opts.MaxZoom < opts.MinZoom {
+		return 0, fmt.Errorf("invalid zoom range %d-%d", opts.MinZoom, opts.MaxZoom)
+	}
+	switch opts.Format {
+	case "", "png", "jpeg", "jpg":
+	default:
+		return 0, fmt.Errorf("unsupported tile format %q", opts.Format)
+	}
+
+	bounds := raster.Bounds()
+	g := &pyramidGenerator{raster: raster, w: w, opts: opts, bounds: bounds}
+	nw := ConstrainTile(LatLngToTile(bounds.NorthWest, opts.MinZoom))
+	se := ConstrainTile(LatLngToTile(bounds.SouthEast, opts.MinZoom))
+	for x := nw.X; x <= se.X; x++ {
+		for y := nw.Y; y <= se.Y; y++ {
+			if _, err := g.generate(Tile{X: x, Y: y, Zoom: opts.MinZoom}); err != nil {
+				return g.count, err
+			}
+		}
+	}
+	return g.count, nil
+}
+
+type pyramidGenerator struct {
+	raster *GeoRaster
+	w      TileWriter
+	opts   PyramidOptions
+	bounds LatLngBounds
+	count  int
+}
+
+// generate writes the tile and all of its descendants down to MaxZoom,
+// depth first so that only one branch of the quadtree is held in memory.
+// It returns nil for tiles without raster data.
+func (g *pyramidGenerator) generate(tile Tile) (*image.RGBA, error) {
+	// Only descend into tiles over the raster, the work then grows with
+	// the raster's area rather than with 4^MaxZoom
+	if !tileIntersects(tile, g.bounds) {
+		return nil, nil
+	}
+	var img *image.RGBA
+	if tile.Zoom == g.opts.MaxZoom {
+		rendered, err := g.raster.RenderTile(tile, g.opts.TileSize, g.opts.Sampling)
+		if errors.Is(err, ErrNoCoverage) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isTransparent(rendered) {
+			return nil, nil
+		}
+		img = rendered
+	} else {
+		size := g.opts.TileSize
+		half := size / 2
+		for i := 0; i < 4; i++ {
+			dx, dy := i&1, i>>1
+			child, err := g.generate(Tile{X: tile.X*2 + dx, Y: tile.Y*2 + dy, Zoom: tile.Zoom + 1})
+			if err != nil {
+				return nil, err
+			}
+			if child == nil {
+				continue
+			}
+			if img == nil {
+				img = image.NewRGBA(image.Rect(0, 0, size, size))
+			}
+			downsample(img, image.Pt(dx*half, dy*half), child)
+		}
+		if img == nil {
+			return nil, nil
+		}
+	}
+
+	data, err := g.encode(img)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.w.WriteTile(tile, data); err != nil {
+		return nil, err
+	}
+	g.count++
+	return img, nil
+}
+
+// tileIntersects reports whether the tile overlaps bounds by more than an
+// edge
+func tileIntersects(tile Tile, bounds LatLngBounds) bool {
+	nw, se := TileBounds(tile)
+	return se.Lng > bounds.NorthWest.Lng && nw.Lng < bounds.SouthEast.Lng &&
+		nw.Lat > bounds.SouthEast.Lat && se.Lat < bounds.NorthWest.Lat
+}
+
+func (g *pyramidGenerator) encode(img *image.RGBA) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch g.opts.Format {
+	case "jpeg", "jpg":
+		quality := g.opts.JPEGQuality
+		if quality <= 0 {
+			quality = 85
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	default:
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+// downsample averages 2x2 blocks of src into the quadrant of dst at off
+func downsample(dst *image.RGBA, off image.Point, src *image.RGBA) {
+	half := src.Bounds().Dx() / 2
+	for y := 0; y < half; y++ {
+		for x := 0; x < half; x++ {
+			d := dst.PixOffset(off.X+x, off.Y+y)
+			s0 := src.PixOffset(x*2, y*2)
+			s1 := s0 + src.Stride
+			for c := 0; c < 4; c++ {
+				sum := int(src.Pix[s0+c]) + int(src.Pix[s0+4+c]) + int(src.Pix[s1+c]) + int(src.Pix[s1+4+c])
+				dst.Pix[d+c] = uint8((sum + 2) / 4)
+			}
+		}
+	}
+}
+
+func isTransparent(img *image.RGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DirTileWriter writes tiles to dir/z/x/y.ext
+type DirTileWriter struct {
+	dir string
+	ext string
+}
+
+func NewDirTileWriter(dir, ext string) *DirTileWriter {
+	return &DirTileWriter{dir: dir, ext: strings.TrimPrefix(ext, ".")}
+}
+
+func (w *DirTileWriter) WriteTile(tile Tile, data []byte) error {
+	dir := filepath.Join(w.dir, strconv.Itoa(tile.Zoom), strconv.Itoa(tile.X))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, strconv.Itoa(tile.Y)+"."+w.ext), data, 0o644)
+}
+
+func (w *DirTileWriter) Close() error {
+	return nil
+}
+
+// MBTilesWriter writes tiles into an MBTiles 1.3 database. The caller
+// opens db with the SQLite driver of its choice.
+type MBTilesWriter struct {
+	db   *sql.DB
+	tx   *sql.Tx
+	stmt *sql.Stmt
+}
+
+// NewMBTilesWriter creates the MBTiles schema in db and stores metadata
+// such as name, format, bounds, minzoom and maxzoom
+func NewMBTilesWriter(db *sql.DB, metadata map[string]string) (*MBTilesWriter, error) {
+	for _, q := range []string{
+		"CREATE TABLE IF NOT EXISTS metadata (name TEXT, value TEXT)",
+		"CREATE TABLE IF NOT EXISTS tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS tile_index ON tiles (zoom_level, tile_column, tile_row)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS name ON metadata (name)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			return nil, fmt.Errorf("mbtiles: %v", err)
+		}
+	}
+	for name, value := range metadata {
+		if _, err := db.Exec("INSERT OR REPLACE INTO metadata (name, value) VALUES (?, ?)", name, value); err != nil {
+			return nil, fmt.Errorf("mbtiles: %v", err)
+		}
+	}
+
+	// Insert all tiles in a single transaction, which is orders of
+	// magnitude faster than one implicit transaction per tile
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("mbtiles: %v", err)
+	}
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("mbtiles: %v", err)
+	}
+	return &MBTilesWriter{db: db, tx: tx, stmt: stmt}, nil
+}
+
+func (w *MBTilesWriter) WriteTile(tile Tile, data []byte) error {
+	// MBTiles rows follow the TMS scheme, counting from the bottom
+	row := (1 << tile.Zoom) - 1 - tile.Y
+	_, err := w.stmt.Exec(tile.Zoom, tile.X, row, data)
+	return err
+}
+
+// Close commits the written tiles. It does not close the database.
+func (w *MBTilesWriter) Close() error {
+	w.stmt.Close()
+	return w.tx.Commit()
+}
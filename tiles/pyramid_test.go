@@ -0,0 +1,120 @@
+package tiles
+
+import (
+	"database/sql"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// memTileWriter keeps the written tiles
+type memTileWriter map[Tile][]byte
+
+func (w memTileWriter) WriteTile(tile Tile, data []byte) error {
+	w[tile] = data
+	return nil
+}
+
+func (w memTileWriter) Close() error {
+	return nil
+}
+
+func TestGeneratePyramidSmallRaster(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	// 0.01° square, inside a single tile at every zoom up to 11
+	raster := &GeoRaster{
+		Image:     img,
+		Transform: TransformFromBounds(LatLngBounds{NorthWest: LatLng{Lat: 50, Lng: 10.1}, SouthEast: LatLng{Lat: 49.99, Lng: 10.11}}, 4, 4),
+		CRS:       EPSG4326,
+	}
+	w := memTileWriter{}
+	n, err := GeneratePyramid(raster, w, PyramidOptions{MinZoom: 0, MaxZoom: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 12 || len(w) != 12 {
+		t.Fatalf("wrote %d tiles (%d stored), want one per zoom", n, len(w))
+	}
+	for z := 0; z <= 11; z++ {
+		tile := LatLngToTile(LatLng{Lat: 49.995, Lng: 10.105}, z)
+		if _, ok := w[tile]; !ok {
+			t.Errorf("tile %v missing", tile)
+		}
+	}
+}
+
+func TestReadWorldFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.pgw")
+	// 2 units per pixel, upper-left pixel centered on (101, 199)
+	if err := os.WriteFile(path, []byte("2\n0\n0\n-2\n101\n199\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := ReadWorldFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (GeoTransform{100, 2, 0, 200, 0, -2}); tr != want {
+		t.Errorf("transform %v, want %v", tr, want)
+	}
+	if found, ok := FindWorldFile(filepath.Join(filepath.Dir(path), "map.png")); !ok || found != path {
+		t.Errorf("found %q, want %q", found, path)
+	}
+
+	if err := os.WriteFile(path, []byte("2\n0\n0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadWorldFile(path); err == nil {
+		t.Error("short world file accepted")
+	}
+}
+
+func TestMBTilesWriterTMSRows(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tiles.mbtiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	w, err := NewMBTilesWriter(db, map[string]string{"name": "test", "format": "png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Row 0 of the XYZ scheme is the top, of TMS the bottom
+	for _, tile := range []Tile{{X: 1, Y: 0, Zoom: 2}, {X: 3, Y: 3, Zoom: 2}, {X: 0, Y: 0, Zoom: 0}} {
+		if err := w.WriteTile(tile, []byte{byte(tile.Y)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ zoom, col, row, y int }{{2, 1, 3, 0}, {2, 3, 0, 3}, {0, 0, 0, 0}} {
+		var data []byte
+		err := db.QueryRow("SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?", tc.zoom, tc.col, tc.row).Scan(&data)
+		if err != nil || len(data) != 1 || int(data[0]) != tc.y {
+			t.Errorf("z%d column %d row %d: %v %v, want the tile of y %d", tc.zoom, tc.col, tc.row, data, err, tc.y)
+		}
+	}
+	var name string
+	if err := db.QueryRow("SELECT value FROM metadata WHERE name = 'name'").Scan(&name); err != nil || name != "test" {
+		t.Errorf("name metadata %q, %v", name, err)
+	}
+}
+
+func TestGeneratePyramidUnsupportedFormat(t *testing.T) {
+	raster := &GeoRaster{
+		Image:     image.NewRGBA(image.Rect(0, 0, 4, 4)),
+		Transform: TransformFromBounds(LatLngBounds{NorthWest: LatLng{Lat: 50, Lng: 10}, SouthEast: LatLng{Lat: 49, Lng: 11}}, 4, 4),
+		CRS:       EPSG4326,
+	}
+	w := memTileWriter{}
+	if _, err := GeneratePyramid(raster, w, PyramidOptions{Format: "webp"}); err == nil || len(w) != 0 {
+		t.Errorf("webp pyramid wrote %d tiles, error %v", len(w), err)
+	}
+}
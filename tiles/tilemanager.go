@@ -1,10 +1,18 @@
 package tiles
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
+	_ "image/jpeg"
 	_ "image/png"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gioui.org/op/paint"
 	"github.com/olablt/gio-tiles/tiles/worker"
@@ -14,99 +22,665 @@ type TileProvider interface {
 	GetTile(tile Tile) (image.Image, error)
 }
 
+// ContextTileProvider is implemented by providers whose requests can be
+// cancelled. TileManager prefers it over GetTile, so that loads stop when
+// they time out or the manager is closed.
+type ContextTileProvider interface {
+	GetTileContext(ctx context.Context, tile Tile) (image.Image, error)
+}
+
+// HostTileProvider is implemented by providers that fetch from a network
+// host. TileManager limits the concurrent loads of each host separately, so
+// that a slow server does not hold up the others.
+type HostTileProvider interface {
+	Host() string
+}
+
+// ErrNoTileData is returned by TileDataProviders that wrap providers
+// without encoded tiles
+var ErrNoTileData = errors.New("provider has no encoded tiles")
+
+// TileDataProvider is implemented by providers that can return tiles in
+// their encoded form, which lets TileManager keep them in a DiskCache
+type TileDataProvider interface {
+	GetTileData(tile Tile) ([]byte, error)
+}
+
+// ContextTileDataProvider is the cancellable form of TileDataProvider
+type ContextTileDataProvider interface {
+	GetTileDataContext(ctx context.Context, tile Tile) ([]byte, error)
+}
+
+// getTile calls GetTileContext when provider implements it
+func getTile(ctx context.Context, provider TileProvider, tile Tile) (image.Image, error) {
+	if cp, ok := provider.(ContextTileProvider); ok {
+		return cp.GetTileContext(ctx, tile)
+	}
+	return provider.GetTile(tile)
+}
+
+// getTileData calls GetTileDataContext when provider implements it, and
+// returns ErrNoTileData when provider has no encoded tiles at all
+func getTileData(ctx context.Context, provider TileProvider, tile Tile) ([]byte, error) {
+	if cp, ok := provider.(ContextTileDataProvider); ok {
+		return cp.GetTileDataContext(ctx, tile)
+	}
+	if dp, ok := provider.(TileDataProvider); ok {
+		return dp.GetTileData(tile)
+	}
+	return nil, ErrNoTileData
+}
+
+// DecodeTile decodes an encoded PNG or JPEG tile
+func DecodeTile(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// TileManagerOptions configures a TileManager
+type TileManagerOptions struct {
+	// CacheBudget bounds the memory held by decoded tiles, DefaultCacheBudget
+	// when zero
+	CacheBudget int64
+	// DiskCache adds a disk tier below the memory cache. Tiles from a
+	// TileDataProvider are written to it in the background and loaded from
+	// it before going to the network. The caller closes it.
+	DiskCache *DiskCache
+	// LoadTimeout bounds loading a single tile, worker.DefaultTimeout when
+	// zero
+	LoadTimeout time.Duration
+	// Pool runs the loads. Managers of different layers can share one so
+	// that the per-host limits of its Limiter apply across layers. A shared
+	// pool is left running by Close and Shutdown. When nil the manager
+	// creates a pool with DefaultWorkers workers and an AIMD limiter per
+	// host.
+	Pool *worker.Pool
+	// MaxPerHost bounds the concurrent loads from a single host by the
+	// manager's own pool, DefaultMaxPerHost when zero. It does not apply
+	// to a shared Pool.
+	MaxPerHost int
+	// RetryDelay is how long GetTile serves the error placeholder of a
+	// failed tile before loading it again, DefaultRetryDelay when zero
+	RetryDelay time.Duration
+	// Prefetch configures loading tiles just outside the view, see
+	// TileManager.Prefetch
+	Prefetch PrefetchOptions
+}
+
+// DefaultRetryDelay is the RetryDelay of failed tiles when not configured
+const DefaultRetryDelay = 10 * time.Second
+
+// DefaultWorkers bounds the concurrent loads of a TileManager's own pool,
+// across all hosts
+const DefaultWorkers = 16
+
+// DefaultMaxPerHost bounds the concurrent loads from a single host. Public
+// tile servers such as tile.openstreetmap.org ask for very few parallel
+// connections.
+const DefaultMaxPerHost = 2
+
+// NewHostPool returns a pool suited for sharing between TileManagers, with
+// an adaptive concurrency limit per host of at most DefaultMaxPerHost
+func NewHostPool() *worker.Pool {
+	return newHostPool(DefaultMaxPerHost)
+}
+
+func newHostPool(maxPerHost int) *worker.Pool {
+	return worker.NewPoolWithOptions(worker.PoolOptions{
+		Workers: DefaultWorkers,
+		Limiter: worker.NewAIMDLimiter(worker.AIMDOptions{Max: maxPerHost}),
+	})
+}
+
 type TileManager struct {
-	cache    Cache
+	images   *Cache[Tile, image.Image]
+	ops      *Cache[Tile, paint.ImageOp]
+	disk     *DiskCache
 	provider TileProvider
 	onLoad   func()
+	onLoadMu sync.RWMutex
+	events   subscribers
+	states   map[Tile]*tileEntry
+	statesMu sync.Mutex
 	pool     *worker.Pool
-	ctx      context.Context
-	cancel   context.CancelFunc
+	ownsPool bool
+	host     string
+	timeout  time.Duration
+	retry    time.Duration
+	prefetch PrefetchOptions
+	// prefetching holds the prefetch loads in flight, by tile
+	prefetching map[Tile]*loadTask
+	// counted holds the tiles GetTile counted a cache hit or miss for since
+	// they were last pinned
+	counted map[Tile]bool
+	// pending counts submitted loads, closed stops new ones
+	pending sync.WaitGroup
+	closed  bool
+	// focus and focusZoom rank queued tiles, see TilePriority
+	focus     LatLng
+	focusZoom int
+	focusMu   sync.RWMutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func NewTileManager(provider TileProvider) *TileManager {
+	return NewTileManagerWithOptions(provider, TileManagerOptions{})
 }
 
-func NewTileManager(provider TileProvider, cacheType CacheType) *TileManager {
+func NewTileManagerWithOptions(provider TileProvider, opts TileManagerOptions) *TileManager {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	var cache Cache
-	switch cacheType {
-	case CacheImageOp:
-		cache = NewImageOpCache()
-	default:
-		cache = NewImageCache()
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultRetryDelay
 	}
-
-	return &TileManager{
-		cache:    cache,
-		provider: provider,
-		pool:     worker.NewPool(4),
-		ctx:      ctx,
-		cancel:   cancel,
+	if opts.MaxPerHost <= 0 {
+		opts.MaxPerHost = DefaultMaxPerHost
+	}
+	pool := opts.Pool
+	if pool == nil {
+		pool = newHostPool(opts.MaxPerHost)
+	}
+	var host string
+	if hp, ok := provider.(HostTileProvider); ok {
+		host = hp.Host()
+	}
+	tm := &TileManager{
+		provider:    provider,
+		disk:        opts.DiskCache,
+		states:      make(map[Tile]*tileEntry),
+		prefetch:    opts.Prefetch.withDefaults(),
+		prefetching: make(map[Tile]*loadTask),
+		counted:     make(map[Tile]bool),
+		pool:        pool,
+		ownsPool:    opts.Pool == nil,
+		host:        host,
+		timeout:     opts.LoadTimeout,
+		retry:       opts.RetryDelay,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
+	// Decoded images are the bounded layer. ImageOps are derived from them
+	// on demand and dropped together with their image, which also releases
+	// the op's GPU texture once it is no longer drawn.
+	tm.ops = NewCache(CacheOptions[Tile, paint.ImageOp]{
+		Loader: func(tile Tile) (paint.ImageOp, error) {
+			img, ok := tm.images.lookup(tile)
+			if !ok {
+				return paint.ImageOp{}, ErrNotCached
+			}
+			return paint.NewImageOp(img), nil
+		},
+	})
+	tm.images = NewCache(CacheOptions[Tile, image.Image]{
+		Name:   "memory",
+		Policy: NewLRUPolicy[Tile](opts.CacheBudget),
+		Size:   ImageBytes,
+		OnEvict: func(tile Tile, _ image.Image) {
+			tm.ops.Delete(tile)
+			tm.evicted(tile)
+		},
+	})
+	return tm
+}
+
+// Images returns the cache of decoded tiles
+func (tm *TileManager) Images() *Cache[Tile, image.Image] {
+	return tm.images
 }
 
-func (tm *TileManager) GetCache() Cache {
-	return tm.cache
+// ImageOp returns the ImageOp of a loaded tile
+func (tm *TileManager) ImageOp(tile Tile) (paint.ImageOp, bool) {
+	op, err := tm.ops.Load(tile)
+	return op, err == nil
 }
 
+// SetOnLoadCallback sets a function called whenever a tile was loaded. Use
+// Subscribe to learn which tile it was.
 func (tm *TileManager) SetOnLoadCallback(callback func()) {
+	tm.onLoadMu.Lock()
 	tm.onLoad = callback
+	tm.onLoadMu.Unlock()
 	if provider, ok := tm.provider.(*CombinedTileProvider); ok {
 		provider.SetOnLoadCallback(callback)
 	}
 }
 
-// getTileKey returns a unique string key for a tile
+// Subscribe calls fn with every TileLoaded, TileFailed and TileEvicted
+// event until the returned function is called. fn runs on the loading
+// goroutines, it must not block and may be called concurrently.
+func (tm *TileManager) Subscribe(fn func(TileEvent)) (unsubscribe func()) {
+	return tm.events.add(fn)
+}
+
+// State returns the state of a tile
+func (tm *TileManager) State(tile Tile) TileStatus {
+	tm.statesMu.Lock()
+	defer tm.statesMu.Unlock()
+	if e, ok := tm.states[tile]; ok {
+		return e.TileStatus
+	}
+	return TileStatus{State: StateAbsent}
+}
+
+// Invalidate marks loaded tiles as stale. They are still drawn, and loaded
+// again the next time they are asked for.
+func (tm *TileManager) Invalidate(tiles ...Tile) {
+	tm.statesMu.Lock()
+	defer tm.statesMu.Unlock()
+	for _, tile := range tiles {
+		if e, ok := tm.states[tile]; ok && e.State == StateLoaded {
+			tm.setState(tile, StateStale, nil)
+		}
+	}
+}
+
+// setState moves a tile to state, statesMu must be held
+func (tm *TileManager) setState(tile Tile, state TileState, err error) *tileEntry {
+	if state == StateAbsent {
+		delete(tm.states, tile)
+		return nil
+	}
+	e, ok := tm.states[tile]
+	if !ok {
+		e = &tileEntry{}
+		tm.states[tile] = e
+	}
+	e.State, e.Err, e.Since = state, err, time.Now()
+	e.placeholder = nil
+	return e
+}
+
+func (tm *TileManager) evicted(tile Tile) {
+	tm.statesMu.Lock()
+	if e, ok := tm.states[tile]; ok && (e.State == StateLoaded || e.State == StateStale) {
+		tm.setState(tile, StateAbsent, nil)
+	}
+	delete(tm.counted, tile)
+	tm.statesMu.Unlock()
+	tm.events.emit(TileEvicted{Tile: tile})
+}
+
+// SetPinned exempts the given tiles, typically the ones in the viewport,
+// from cache eviction
+func (tm *TileManager) SetPinned(tiles []Tile) {
+	tm.images.SetPinned(tiles)
+
+	pinned := make(map[Tile]bool, len(tiles))
+	for _, tile := range tiles {
+		pinned[tile] = true
+	}
+	tm.statesMu.Lock()
+	for tile := range tm.counted {
+		if !pinned[tile] {
+			delete(tm.counted, tile)
+		}
+	}
+	tm.statesMu.Unlock()
+}
+
+// GetTileKey returns a printable z/x/y key for a tile
 func GetTileKey(tile Tile) string {
 	return fmt.Sprintf("%d/%d/%d", tile.Zoom, tile.X, tile.Y)
 }
 
 func (tm *TileManager) GetTile(tile Tile) (image.Image, error) {
-	key := GetTileKey(tile)
-
-	// First check if we already have the OSM tile cached
-	if cached, exists := tm.cache.Get(key); exists {
-		switch tm.cache.GetType() {
-		case CacheImage:
-			if img, ok := cached.(image.Image); ok {
-				return img, nil
-			}
-		case CacheImageOp:
-			if imgOp, ok := cached.(paint.ImageOp); ok {
-				_ = imgOp
-				// We have the OSM tile cached
-				return tm.provider.GetTile(tile)
-			}
+	img, exists := tm.images.lookup(tile)
+
+	tm.statesMu.Lock()
+	e := tm.states[tile]
+	var load bool
+	switch {
+	case tm.closed:
+	case e == nil || e.State == StateLoaded:
+		// A loaded tile may have been evicted before it was marked loaded
+		load = !exists
+	case e.State == StateStale:
+		load = true
+	case e.State == StateFailed:
+		load = time.Since(e.Since) >= tm.retry
+	}
+	if load {
+		tm.setState(tile, StateQueued, nil)
+		tm.pending.Add(1)
+	}
+	// Views ask for their tiles every frame, so a tile is counted once
+	// while it stays pinned: as a miss when its load starts, or as a hit
+	// when the cached image saves one
+	if !tm.counted[tile] && (exists || load) {
+		tm.counted[tile] = true
+		if exists {
+			cacheHits.Inc("memory")
+		} else {
+			cacheMisses.Inc("memory")
 		}
 	}
+	// A tile that became visible while prefetching is no longer optional
+	promoted := tm.prefetching[tile]
+	if promoted != nil {
+		promoted.prefetch.Store(false)
+		delete(tm.prefetching, tile)
+	}
+	var placeholder image.Image
+	if !load && e != nil && e.State == StateFailed {
+		if e.placeholder == nil {
+			e.placeholder = ErrorTile(tile, e.Err)
+		}
+		placeholder = e.placeholder
+	}
+	tm.statesMu.Unlock()
+	if load {
+		tm.submit(&loadTask{tile: tile, owner: tm, ctx: tm.ctx})
+	}
+	if promoted != nil {
+		tm.reprioritize()
+	}
 
-	// Start async loading of OSM tile if not already loading
-	tm.pool.Submit(worker.Task{
-		Ctx: tm.ctx,
-		Work: func() error {
-			img, err := tm.provider.GetTile(tile)
+	// Stale tiles are drawn until their replacement is loaded
+	if exists {
+		return img, nil
+	}
+	if placeholder != nil {
+		return placeholder, nil
+	}
+
+	// Return local tile immediately while OSM loads
+	if localProvider, ok := tm.provider.(*CombinedTileProvider); ok {
+		return localProvider.fallback.GetTile(tile)
+	}
+
+	// Fallback if not using CombinedTileProvider
+	return tm.provider.GetTile(tile)
+}
+
+// SetViewport sets the point tiles load outward from, usually the cursor or
+// the viewport center, and the zoom level the view is heading to. Queued
+// tiles are reordered accordingly.
+func (tm *TileManager) SetViewport(focus LatLng, zoom int) {
+	tm.focusMu.Lock()
+	tm.focus, tm.focusZoom = focus, zoom
+	tm.focusMu.Unlock()
+	tm.reprioritize()
+}
+
+func (tm *TileManager) reprioritize() {
+	tm.pool.Reprioritize(func(task worker.Task) int {
+		if lt, ok := task.Key.(*loadTask); ok && lt.owner == tm {
+			return tm.priority(lt)
+		}
+		// A task of another manager sharing the pool
+		return task.Priority
+	})
+}
+
+// prefetchPenalty ranks prefetch loads after all other loads
+const prefetchPenalty = 1 << 26
+
+func (tm *TileManager) priority(lt *loadTask) int {
+	tm.focusMu.RLock()
+	priority := TilePriority(lt.tile, tm.focus, tm.focusZoom)
+	tm.focusMu.RUnlock()
+	if lt.prefetch.Load() {
+		priority -= prefetchPenalty
+	}
+	return priority
+}
+
+// Prefetch loads tiles the view is likely to show next, as planned by
+// PlanPrefetch. The loads run after all loads of visible tiles, and at most
+// the Budget of the manager's PrefetchOptions are in flight. Prefetch loads
+// no longer in the plan are cancelled, so it should be called whenever the
+// view moves.
+func (tm *TileManager) Prefetch(v Viewport) {
+	if tm.prefetch.Disabled {
+		return
+	}
+	plan := PlanPrefetch(v, tm.prefetch)
+
+	tm.statesMu.Lock()
+	if tm.closed {
+		tm.statesMu.Unlock()
+		return
+	}
+	planned := make(map[Tile]bool, len(plan))
+	for _, tile := range plan {
+		planned[tile] = true
+	}
+	visible := make(map[Tile]bool)
+	for _, tile := range CalculateVisibleTiles(v.Center, int(math.Round(v.Zoom)), v.Size) {
+		visible[tile] = true
+	}
+	promoted := false
+	for tile, lt := range tm.prefetching {
+		switch {
+		case visible[tile]:
+			// Prefetched just in time
+			lt.prefetch.Store(false)
+			delete(tm.prefetching, tile)
+			promoted = true
+		case !planned[tile]:
+			lt.cancel()
+			delete(tm.prefetching, tile)
+		}
+	}
+	var submit []*loadTask
+	for _, tile := range plan {
+		if len(tm.prefetching) >= tm.prefetch.Budget {
+			break
+		}
+		if _, known := tm.states[tile]; known {
+			// Loaded, on its way or failed
+			continue
+		}
+		lt := &loadTask{tile: tile, owner: tm}
+		lt.prefetch.Store(true)
+		ctx, cancel := context.WithCancel(tm.ctx)
+		lt.ctx, lt.cancel = ctx, cancel
+		tm.setState(tile, StateQueued, nil)
+		tm.pending.Add(1)
+		tm.prefetching[tile] = lt
+		submit = append(submit, lt)
+	}
+	tm.statesMu.Unlock()
+
+	for _, lt := range submit {
+		tm.submit(lt)
+	}
+	if promoted {
+		tm.reprioritize()
+	}
+}
+
+// TilePriority ranks a tile for loading, higher values first. Tiles at the
+// target zoom come before all other zoom levels, and within a zoom level
+// tiles nearer to the focus point come first.
+func TilePriority(tile Tile, focus LatLng, zoom int) int {
+	fx, fy := CalculateWorldCoordinates(focus, float64(tile.Zoom))
+	tx := (float64(tile.X) + 0.5) * TileSize
+	ty := (float64(tile.Y) + 0.5) * TileSize
+	// Distance in sixteenths of a tile keeps neighbours apart
+	priority := -int(math.Hypot(tx-fx, ty-fy) / TileSize * 16)
+	if tile.Zoom != zoom {
+		priority -= 1 << 24
+	}
+	return priority
+}
+
+// loadTask is the Key of the pool tasks loading tiles
+type loadTask struct {
+	tile  Tile
+	owner *TileManager
+	// prefetch is cleared when a prefetched tile is asked for
+	prefetch atomic.Bool
+	// ctx and cancel stop the load, cancel is only set for prefetch loads
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (tm *TileManager) submit(lt *loadTask) {
+	tile := lt.tile
+	err := tm.pool.Submit(worker.Task{
+		Ctx: lt.ctx,
+		Work: func(ctx context.Context) error {
+			tm.statesMu.Lock()
+			tm.setState(tile, StateLoading, nil)
+			tm.statesMu.Unlock()
+
+			img, err := tm.load(ctx, tile)
 			if err != nil {
 				return err
 			}
 
-			switch tm.cache.GetType() {
-			case CacheImage:
-				tm.cache.Set(key, img)
-			case CacheImageOp:
-				tm.cache.Set(key, paint.NewImageOp(img))
-			}
+			tm.images.Set(tile, img)
+			// Replace an op created from an older image of the tile
+			tm.ops.Delete(tile)
+			tm.statesMu.Lock()
+			tm.setState(tile, StateLoaded, nil)
+			tm.statesMu.Unlock()
 
-			if tm.onLoad != nil {
-				tm.onLoad()
+			tm.events.emit(TileLoaded{Tile: tile, Image: img})
+			tm.onLoadMu.RLock()
+			onLoad := tm.onLoad
+			tm.onLoadMu.RUnlock()
+			if onLoad != nil {
+				onLoad()
 			}
 			return nil
 		},
-		Priority: tile.Zoom,
+		Timeout:  tm.timeout,
+		Priority: tm.priority(lt),
+		Key:      lt,
+		Group:    tm.host,
+		OnResult: tm.loaded,
 	})
+	if err != nil {
+		// The pool is closed
+		tm.loaded(worker.Result{Key: lt, Outcome: worker.Cancelled, Err: err})
+	}
+}
 
-	// Return local tile immediately while OSM loads
-	if localProvider, ok := tm.provider.(*CombinedTileProvider); ok {
-		return localProvider.fallback.GetTile(tile)
+// loaded ends the load of a tile, whatever its outcome. The next GetTile
+// of a tile that failed to load tries again.
+func (tm *TileManager) loaded(result worker.Result) {
+	lt := result.Key.(*loadTask)
+	tile := lt.tile
+	defer tm.pending.Done()
+
+	switch result.Outcome {
+	case worker.Failed:
+		log.Printf("TileManager: loading tile %v failed: %v", tile, result.Err)
+	case worker.TimedOut:
+		log.Printf("TileManager: loading tile %v timed out after %v", tile, result.Duration)
 	}
 
-	// Fallback if not using CombinedTileProvider
-	return tm.provider.GetTile(tile)
+	tm.statesMu.Lock()
+	if tm.prefetching[tile] == lt {
+		delete(tm.prefetching, tile)
+	}
+	if lt.cancel != nil {
+		lt.cancel()
+	}
+	_, cached := tm.images.lookup(tile)
+	switch {
+	case result.Outcome == worker.Success:
+	case result.Outcome == worker.Cancelled && cached:
+		tm.setState(tile, StateStale, nil)
+	case result.Outcome == worker.Cancelled:
+		tm.setState(tile, StateAbsent, nil)
+	default:
+		tm.setState(tile, StateFailed, result.Err)
+	}
+	tm.statesMu.Unlock()
+
+	if result.Outcome == worker.Failed || result.Outcome == worker.TimedOut {
+		tm.events.emit(TileFailed{Tile: tile, Err: result.Err, TimedOut: result.Outcome == worker.TimedOut})
+	}
+}
+
+// Shutdown stops loading new tiles and waits for the queued loads to
+// finish. If ctx ends first, the remaining loads are cancelled and ctx's
+// error is returned. The DiskCache, if any, is left open for the caller.
+func (tm *TileManager) Shutdown(ctx context.Context) error {
+	tm.stop()
+	done := make(chan struct{})
+	go func() {
+		tm.pending.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	tm.cancel()
+	<-done
+	if tm.ownsPool {
+		tm.pool.Close()
+	}
+	return err
+}
+
+// Close cancels queued and running loads and waits for them to return.
+// Tiles already loaded stay available. Close may be called more than once.
+func (tm *TileManager) Close() error {
+	tm.stop()
+	tm.cancel()
+	tm.pending.Wait()
+	if tm.ownsPool {
+		return tm.pool.Close()
+	}
+	return nil
+}
+
+// stop makes GetTile serve placeholders only
+func (tm *TileManager) stop() {
+	tm.statesMu.Lock()
+	tm.closed = true
+	tm.statesMu.Unlock()
+}
+
+// Context is cancelled once the manager is closed
+func (tm *TileManager) Context() context.Context {
+	return tm.ctx
+}
+
+// load fetches a tile from the disk tier or the provider. Tiles fetched
+// from a TileDataProvider are queued for the disk tier.
+func (tm *TileManager) load(ctx context.Context, tile Tile) (image.Image, error) {
+	if tm.disk == nil {
+		return getTile(ctx, tm.provider, tile)
+	}
+
+	data, err := tm.disk.Get(tile)
+	if err == nil {
+		img, err := DecodeTile(data)
+		if err == nil {
+			cacheHits.Inc("disk")
+			return img, nil
+		}
+		// The file would fail the same way on every load
+		log.Printf("TileManager: undecodable disk tile %v, fetching it again: %v", tile, err)
+		if err := tm.disk.Delete(tile); err != nil {
+			log.Printf("TileManager: error deleting disk tile %v: %v", tile, err)
+		}
+	} else if errors.Is(err, ErrCorrupt) {
+		log.Printf("TileManager: corrupt disk tile %v, fetching it again", tile)
+	}
+	cacheMisses.Inc("disk")
+
+	data, err = getTileData(ctx, tm.provider, tile)
+	if errors.Is(err, ErrNoTileData) {
+		return getTile(ctx, tm.provider, tile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, err := DecodeTile(data)
+	if err != nil {
+		return nil, err
+	}
+	tm.disk.Store(tile, data)
+	return img, nil
 }
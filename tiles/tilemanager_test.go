@@ -0,0 +1,336 @@
+package tiles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/olablt/gio-tiles/tiles/tiletest"
+)
+
+func TestTileManagerLoadsAsync(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	srv.SetDefault(tiletest.Behavior{Latency: 20 * time.Millisecond})
+	tm := NewTileManager(
+		NewCombinedTileProvider(
+			NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+			NewLocalTileProvider(),
+		),
+	)
+	loaded := make(chan struct{}, 10)
+	tm.SetOnLoadCallback(func() { loaded <- struct{}{} })
+
+	tile := Tile{X: 5, Y: 6, Zoom: 7}
+	if _, err := tm.GetTile(tile); err != nil {
+		t.Fatalf("GetTile: %v", err)
+	}
+
+	select {
+	case <-loaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tile was never loaded")
+	}
+
+	cached, ok := tm.Images().Get(tile)
+	if !ok {
+		t.Fatal("loaded tile is not cached")
+	}
+	if _, ok := tm.ImageOp(tile); !ok {
+		t.Error("no ImageOp for the loaded tile")
+	}
+	r, g, b, _ := cached.At(0, 0).RGBA()
+	want := tiletest.TileColor(7, 5, 6)
+	if uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B {
+		t.Errorf("cached tile has color %d,%d,%d, want %v", r>>8, g>>8, b>>8, want)
+	}
+}
+
+func TestTilePriorityPrefersFocusAndTargetZoom(t *testing.T) {
+	focus := LatLng{Lat: 51.5, Lng: -0.12}
+	under := LatLngToTile(focus, 10)
+	near := Tile{X: under.X + 1, Y: under.Y, Zoom: 10}
+	far := Tile{X: under.X + 5, Y: under.Y + 5, Zoom: 10}
+	other := LatLngToTile(focus, 9)
+
+	pUnder := TilePriority(under, focus, 10)
+	pNear := TilePriority(near, focus, 10)
+	pFar := TilePriority(far, focus, 10)
+	pOther := TilePriority(other, focus, 10)
+	if !(pUnder > pNear && pNear > pFar && pFar > pOther) {
+		t.Fatalf("priorities under=%d near=%d far=%d other zoom=%d", pUnder, pNear, pFar, pOther)
+	}
+}
+
+func TestTileManagerClose(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	tm := NewTileManager(
+		NewCombinedTileProvider(
+			NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+			NewLocalTileProvider(),
+		),
+	)
+	if err := tm.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := tm.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if tm.Context().Err() == nil {
+		t.Error("context not cancelled by Close")
+	}
+
+	// A closed manager still serves placeholders but fetches nothing
+	if _, err := tm.GetTile(Tile{X: 1, Y: 1, Zoom: 2}); err != nil {
+		t.Fatalf("GetTile after Close: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := srv.TotalRequests(); n != 0 {
+		t.Errorf("closed manager made %d requests", n)
+	}
+}
+
+func TestTileManagerLoadTimeout(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	srv.SetDefault(tiletest.Behavior{Latency: time.Second})
+	tm := NewTileManagerWithOptions(
+		NewCombinedTileProvider(
+			NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+			NewLocalTileProvider(),
+		),
+		TileManagerOptions{LoadTimeout: 50 * time.Millisecond, RetryDelay: time.Millisecond},
+	)
+	defer tm.Close()
+
+	tile := Tile{X: 1, Y: 2, Zoom: 3}
+	failed := make(chan TileFailed, 10)
+	tm.Subscribe(func(ev TileEvent) {
+		if ev, ok := ev.(TileFailed); ok {
+			failed <- ev
+		}
+	})
+	tm.GetTile(tile)
+	select {
+	case ev := <-failed:
+		if ev.Tile != tile || !ev.TimedOut {
+			t.Errorf("got %+v, want a timeout of %v", ev, tile)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no TileFailed event")
+	}
+	if st := tm.State(tile); st.State != StateFailed && st.State != StateQueued {
+		t.Errorf("tile is %v after timing out", st.State)
+	}
+	// The timed out load releases the tile, so asking again fetches again
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for srv.Requests(3, 1, 2) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		tm.GetTile(tile)
+	}
+	if n := srv.Requests(3, 1, 2); n < 2 {
+		t.Errorf("got %d requests within 500ms, the first load did not time out", n)
+	}
+	if _, ok := tm.Images().Get(tile); ok {
+		t.Error("timed out tile was cached")
+	}
+}
+
+func TestTileManagerMaxPerHost(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	for _, tc := range []struct{ max, want int }{{0, DefaultMaxPerHost}, {3, 3}} {
+		srv.Reset()
+		srv.SetDefault(tiletest.Behavior{Latency: 20 * time.Millisecond})
+		tm := NewTileManagerWithOptions(
+			NewCombinedTileProvider(
+				NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+				NewLocalTileProvider(),
+			),
+			TileManagerOptions{MaxPerHost: tc.max},
+		)
+		done := make(chan TileEvent, 24)
+		tm.Subscribe(func(ev TileEvent) { done <- ev })
+		for x := 0; x < 24; x++ {
+			tm.GetTile(Tile{X: x, Y: 0, Zoom: 5})
+		}
+		for i := 0; i < 24; i++ {
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("tiles were not loaded")
+			}
+		}
+		tm.Close()
+		if n := srv.MaxInFlight(); n > tc.want {
+			t.Errorf("MaxPerHost %d: %d requests at once, want at most %d", tc.max, n, tc.want)
+		}
+	}
+}
+
+func TestTileManagersSharePool(t *testing.T) {
+	basemap := tiletest.NewServer()
+	defer basemap.Close()
+	slow := tiletest.NewServer()
+	defer slow.Close()
+	slow.SetDefault(tiletest.Behavior{Latency: time.Second})
+
+	pool := NewHostPool()
+	defer pool.Close()
+	newManager := func(url string) *TileManager {
+		return NewTileManagerWithOptions(
+			NewCombinedTileProvider(
+				NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: url}),
+				NewLocalTileProvider(),
+			),
+			TileManagerOptions{Pool: pool},
+		)
+	}
+	overlay := newManager(slow.URL)
+	base := newManager(basemap.URL)
+	defer base.Close()
+
+	// Saturate the slow host, then close its manager
+	for x := 0; x < 16; x++ {
+		overlay.GetTile(Tile{X: x, Y: 0, Zoom: 4})
+	}
+	if err := overlay.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	loaded := make(chan struct{}, 1)
+	base.SetOnLoadCallback(func() { loaded <- struct{}{} })
+	base.GetTile(Tile{X: 1, Y: 1, Zoom: 4})
+	select {
+	case <-loaded:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("basemap tile held up by the slow host")
+	}
+}
+
+func TestTileManagerStatesAndEvents(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	srv.SetBehavior(3, 2, 2, tiletest.Behavior{StatusCode: 500})
+	tm := NewTileManager(
+		NewCombinedTileProvider(
+			NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+			NewLocalTileProvider(),
+		),
+	)
+	defer tm.Close()
+
+	events := make(chan TileEvent, 10)
+	unsubscribe := tm.Subscribe(func(ev TileEvent) { events <- ev })
+	next := func() TileEvent {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+		return nil
+	}
+
+	good, bad := Tile{X: 1, Y: 1, Zoom: 3}, Tile{X: 2, Y: 2, Zoom: 3}
+	if st := tm.State(good); st.State != StateAbsent {
+		t.Errorf("unrequested tile is %v", st.State)
+	}
+	tm.GetTile(good)
+	if ev, ok := next().(TileLoaded); !ok || ev.Tile != good {
+		t.Fatalf("got %#v, want TileLoaded of %v", ev, good)
+	}
+	if st := tm.State(good); st.State != StateLoaded {
+		t.Errorf("loaded tile is %v", st.State)
+	}
+
+	tm.GetTile(bad)
+	if ev, ok := next().(TileFailed); !ok || ev.Tile != bad || ev.TimedOut {
+		t.Fatalf("got %#v, want TileFailed of %v", ev, bad)
+	}
+	st := tm.State(bad)
+	if st.State != StateFailed || st.Err == nil {
+		t.Errorf("failed tile is %v with error %v", st.State, st.Err)
+	}
+	// Failed tiles get an error placeholder and are not retried at once
+	placeholder, _ := tm.GetTile(bad)
+	if placeholder == nil || srv.Requests(3, 2, 2) != 1 {
+		t.Errorf("failed tile retried or without placeholder")
+	}
+
+	// Stale tiles are served while they load again
+	tm.Invalidate(good)
+	if st := tm.State(good); st.State != StateStale {
+		t.Errorf("invalidated tile is %v", st.State)
+	}
+	if img, _ := tm.GetTile(good); img == nil {
+		t.Error("stale tile not served")
+	}
+	if _, ok := next().(TileLoaded); !ok {
+		t.Error("stale tile not loaded again")
+	}
+	if n := srv.Requests(3, 1, 1); n != 2 {
+		t.Errorf("got %d requests for the stale tile, want 2", n)
+	}
+
+	unsubscribe()
+	tm.Invalidate(good)
+	tm.GetTile(good)
+	select {
+	case ev := <-events:
+		t.Errorf("got %#v after unsubscribing", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTileManagerCountsCacheTrafficOncePerLoad(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	srv.SetDefault(tiletest.Behavior{Latency: 50 * time.Millisecond})
+	tm := NewTileManager(
+		NewCombinedTileProvider(
+			NewOSMTileProviderWithOptions(OSMTileProviderOptions{BaseURL: srv.URL}),
+			NewLocalTileProvider(),
+		),
+	)
+	defer tm.Close()
+	loaded := make(chan struct{}, 10)
+	tm.SetOnLoadCallback(func() { loaded <- struct{}{} })
+
+	hits, misses := cacheHits.Value("memory"), cacheMisses.Value("memory")
+	// A view asks for the tile every frame until it is loaded
+	tile := Tile{X: 1, Y: 2, Zoom: 3}
+	for i := 0; i < 10; i++ {
+		tm.ImageOp(tile)
+		tm.GetTile(tile)
+	}
+	select {
+	case <-loaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tile was never loaded")
+	}
+	// Drawing the loaded tile is not a hit, the miss already counted it
+	for i := 0; i < 10; i++ {
+		tm.ImageOp(tile)
+		tm.GetTile(tile)
+	}
+	if n := cacheMisses.Value("memory") - misses; n != 1 {
+		t.Errorf("counted %v misses, want 1", n)
+	}
+	if n := cacheHits.Value("memory") - hits; n != 0 {
+		t.Errorf("counted %v hits, want 0", n)
+	}
+
+	// Once off screen, coming back is a single hit however many frames ask
+	tm.SetPinned(nil)
+	for i := 0; i < 10; i++ {
+		tm.SetPinned([]Tile{tile})
+		tm.GetTile(tile)
+	}
+	if n := cacheHits.Value("memory") - hits; n != 1 {
+		t.Errorf("counted %v hits, want 1", n)
+	}
+	if n := cacheMisses.Value("memory") - misses; n != 1 {
+		t.Errorf("counted %v misses, want 1", n)
+	}
+}
@@ -0,0 +1,125 @@
+package tiles
+
+import (
+	"image"
+	"sync"
+	"time"
+)
+
+// TileState is a step in the life of a tile in a TileManager
+type TileState int
+
+const (
+	// StateAbsent tiles were never requested or have been evicted
+	StateAbsent TileState = iota
+	// StateQueued tiles wait for a worker
+	StateQueued
+	// StateLoading tiles are being read from disk or fetched
+	StateLoading
+	// StateLoaded tiles are in the memory cache
+	StateLoaded
+	// StateFailed tiles could not be loaded, GetTile tries again after the
+	// manager's RetryDelay
+	StateFailed
+	// StateStale tiles are in the memory cache but outdated, GetTile still
+	// returns them while loading them again
+	StateStale
+)
+
+func (s TileState) String() string {
+	switch s {
+	case StateAbsent:
+		return "absent"
+	case StateQueued:
+		return "queued"
+	case StateLoading:
+		return "loading"
+	case StateLoaded:
+		return "loaded"
+	case StateFailed:
+		return "failed"
+	case StateStale:
+		return "stale"
+	}
+	return "unknown"
+}
+
+// TileStatus is the state of a tile together with its last error
+type TileStatus struct {
+	State TileState
+	// Err is the error of the last failed load
+	Err error
+	// Since is when the tile entered State
+	Since time.Time
+}
+
+// TileEvent is delivered to TileManager subscribers, it is a TileLoaded,
+// TileFailed or TileEvicted
+type TileEvent interface {
+	tileEvent()
+}
+
+// TileLoaded reports a tile that is now in the memory cache
+type TileLoaded struct {
+	Tile  Tile
+	Image image.Image
+}
+
+// TileFailed reports a tile that could not be loaded
+type TileFailed struct {
+	Tile     Tile
+	Err      error
+	TimedOut bool
+}
+
+// TileEvicted reports a loaded tile dropped from the memory cache
+type TileEvicted struct {
+	Tile Tile
+}
+
+func (TileLoaded) tileEvent()  {}
+func (TileFailed) tileEvent()  {}
+func (TileEvicted) tileEvent() {}
+
+// tileEntry is the state a TileManager keeps for every tile that is not
+// StateAbsent
+type tileEntry struct {
+	TileStatus
+	// placeholder is the error tile drawn for a failed tile
+	placeholder image.Image
+}
+
+// subscribers is a set of event listeners safe for concurrent use
+type subscribers struct {
+	mu        sync.RWMutex
+	next      int
+	listeners map[int]func(TileEvent)
+}
+
+func (s *subscribers) add(fn func(TileEvent)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[int]func(TileEvent))
+	}
+	id := s.next
+	s.next++
+	s.listeners[id] = fn
+	return func() {
+		s.mu.Lock()
+		delete(s.listeners, id)
+		s.mu.Unlock()
+	}
+}
+
+func (s *subscribers) emit(ev TileEvent) {
+	s.mu.RLock()
+	listeners := make([]func(TileEvent), 0, len(s.listeners))
+	for _, fn := range s.listeners {
+		listeners = append(listeners, fn)
+	}
+	s.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(ev)
+	}
+}
@@ -0,0 +1,193 @@
+// Package tiletest provides an in-process fake tile server for tests.
+//
+// The server answers /{z}/{x}/{y}.png with deterministic solid-color PNG
+// tiles and can be told to add latency or misbehave per tile, so providers,
+// caches and the worker pool can be exercised without network access.
+package tiletest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Behavior describes how the server answers a tile request
+type Behavior struct {
+	// Latency delays the response, or until the client gives up
+	Latency time.Duration
+	// StatusCode replaces the 200 response when non-zero
+	StatusCode int
+	// RetryAfter sets the Retry-After header, in seconds
+	RetryAfter int
+	// Truncate cuts the PNG body in half
+	Truncate bool
+	// InvalidImage answers with bytes that are not an image
+	InvalidImage bool
+}
+
+// RateLimited returns the behavior of a throttling tile server
+func RateLimited(retryAfter int) Behavior {
+	return Behavior{StatusCode: http.StatusTooManyRequests, RetryAfter: retryAfter}
+}
+
+type tileKey struct {
+	z, x, y int
+}
+
+// Server is a fake slippy map tile server
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	defaults    Behavior
+	behaviors   map[tileKey]Behavior
+	requests    map[tileKey]int
+	total       int
+	inFlight    int
+	maxInFlight int
+}
+
+// NewServer starts a server that serves every tile successfully. Close it
+// when done.
+func NewServer() *Server {
+	s := &Server{
+		behaviors: make(map[tileKey]Behavior),
+		requests:  make(map[tileKey]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetDefault sets the behavior of tiles without their own behavior
+func (s *Server) SetDefault(b Behavior) {
+	s.mu.Lock()
+	s.defaults = b
+	s.mu.Unlock()
+}
+
+// SetBehavior overrides the behavior for a single tile
+func (s *Server) SetBehavior(z, x, y int, b Behavior) {
+	s.mu.Lock()
+	s.behaviors[tileKey{z, x, y}] = b
+	s.mu.Unlock()
+}
+
+// Reset clears all behaviors and request counters
+func (s *Server) Reset() {
+	s.mu.Lock()
+	s.defaults = Behavior{}
+	s.behaviors = make(map[tileKey]Behavior)
+	s.requests = make(map[tileKey]int)
+	s.total = 0
+	s.maxInFlight = 0
+	s.mu.Unlock()
+}
+
+// Requests returns how many times a tile was requested
+func (s *Server) Requests(z, x, y int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[tileKey{z, x, y}]
+}
+
+// TotalRequests returns the number of requests for any path
+func (s *Server) TotalRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// MaxInFlight returns the highest number of concurrent requests seen
+func (s *Server) MaxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInFlight
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var key tileKey
+	_, err := fmt.Sscanf(r.URL.Path, "/%d/%d/%d.png", &key.z, &key.x, &key.y)
+
+	s.mu.Lock()
+	s.total++
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.requests[key]++
+	b, ok := s.behaviors[key]
+	if !ok {
+		b = s.defaults
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if b.Latency > 0 {
+		select {
+		case <-time.After(b.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if b.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(b.RetryAfter))
+	}
+	if b.StatusCode != 0 && b.StatusCode != http.StatusOK {
+		http.Error(w, http.StatusText(b.StatusCode), b.StatusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	if b.InvalidImage {
+		w.Write([]byte("this is not a png"))
+		return
+	}
+	data := EncodeTile(key.z, key.x, key.y)
+	if b.Truncate {
+		// Announce the full length so the client sees an unexpected EOF
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data[:len(data)/2])
+		return
+	}
+	w.Write(data)
+}
+
+// TileColor returns the color of the deterministic tile z/x/y
+func TileColor(z, x, y int) color.RGBA {
+	return color.RGBA{R: uint8(x * 37), G: uint8(y * 59), B: uint8(z * 13), A: 255}
+}
+
+// TileImage returns the deterministic tile z/x/y
+func TileImage(z, x, y int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	c := TileColor(z, x, y)
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i+0] = c.R
+		img.Pix[i+1] = c.G
+		img.Pix[i+2] = c.B
+		img.Pix[i+3] = c.A
+	}
+	return img
+}
+
+// EncodeTile returns the PNG encoding of the deterministic tile z/x/y
+func EncodeTile(z, x, y int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, TileImage(z, x, y))
+	return buf.Bytes()
+}
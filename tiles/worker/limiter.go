@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/olablt/gio-tiles/tiles/metrics"
+)
+
+var groupLimit = metrics.Default.Gauge("gio_tiles_pool_group_limit", "Running tasks allowed per group by adaptive limiters.", "group")
+
+// Limiter bounds the running tasks of each task Group. Its methods are
+// called with the pool's lock held, so never at the same time by one pool,
+// and must not call back into the pool.
+type Limiter interface {
+	// Limit returns how many tasks of group may run at once, zero or less
+	// for no limit
+	Limit(group string) int
+	// Observe is told the result of every task of group that ran to
+	// completion, cancelled tasks excluded
+	Observe(group string, result Result)
+}
+
+// StaticLimiter applies fixed per-group limits
+type StaticLimiter struct {
+	// Limits maps groups to their limit
+	Limits map[string]int
+	// Default is the limit of groups missing from Limits
+	Default int
+}
+
+func (l StaticLimiter) Limit(group string) int {
+	if n, ok := l.Limits[group]; ok {
+		return n
+	}
+	return l.Default
+}
+
+func (l StaticLimiter) Observe(group string, result Result) {}
+
+// AIMDOptions configures an AIMDLimiter
+type AIMDOptions struct {
+	// Initial is the limit of a group before any results, 4 when zero
+	Initial int
+	// Min and Max bound the limit, 1 and 16 when zero
+	Min, Max int
+	// TargetLatency is the slowest successful task that still counts as
+	// healthy, 1s when zero
+	TargetLatency time.Duration
+	// Backoff multiplies the limit on a slow or failed task, 0.5 when zero
+	Backoff float64
+}
+
+// AIMDLimiter adapts the limit of each group with additive increase and
+// multiplicative decrease. Every healthy task raises the limit by 1/limit,
+// about one per round of tasks, so fast servers are soon used in parallel.
+// A failed, timed out or slow task multiplies it by Backoff, at most once
+// per round so that a burst of errors from the same round counts once.
+type AIMDLimiter struct {
+	opts   AIMDOptions
+	mu     sync.Mutex
+	groups map[string]*aimdGroup
+}
+
+type aimdGroup struct {
+	limit float64
+	// cooldown is the number of results to ignore for backing off
+	cooldown int
+}
+
+func NewAIMDLimiter(opts AIMDOptions) *AIMDLimiter {
+	if opts.Min <= 0 {
+		opts.Min = 1
+	}
+	if opts.Max <= 0 {
+		opts.Max = 16
+	}
+	if opts.Initial <= 0 {
+		opts.Initial = 4
+	}
+	opts.Initial = max(opts.Min, min(opts.Initial, opts.Max))
+	if opts.TargetLatency <= 0 {
+		opts.TargetLatency = time.Second
+	}
+	if opts.Backoff <= 0 || opts.Backoff >= 1 {
+		opts.Backoff = 0.5
+	}
+	return &AIMDLimiter{opts: opts, groups: make(map[string]*aimdGroup)}
+}
+
+func (l *AIMDLimiter) group(name string) *aimdGroup {
+	g, ok := l.groups[name]
+	if !ok {
+		g = &aimdGroup{limit: float64(l.opts.Initial)}
+		l.groups[name] = g
+	}
+	return g
+}
+
+func (l *AIMDLimiter) Limit(group string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.group(group).limit)
+}
+
+func (l *AIMDLimiter) Observe(group string, result Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g := l.group(group)
+
+	healthy := result.Outcome == Success && result.Duration <= l.opts.TargetLatency
+	if g.cooldown > 0 {
+		g.cooldown--
+	}
+	switch {
+	case healthy:
+		g.limit = min(g.limit+1/g.limit, float64(l.opts.Max))
+	case g.cooldown == 0:
+		// The tasks still running were started under the old limit
+		g.cooldown = int(g.limit)
+		g.limit = max(g.limit*l.opts.Backoff, float64(l.opts.Min))
+	}
+	groupLimit.Set(float64(int(g.limit)), group)
+}
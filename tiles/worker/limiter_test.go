@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAIMDLimiter(t *testing.T) {
+	l := NewAIMDLimiter(AIMDOptions{Initial: 2, Max: 8, TargetLatency: 100 * time.Millisecond})
+	fast := Result{Outcome: Success, Duration: 10 * time.Millisecond}
+
+	for i := 0; i < 50; i++ {
+		l.Observe("fast", fast)
+	}
+	if n := l.Limit("fast"); n != 8 {
+		t.Errorf("fast group limit %d after healthy results, want 8", n)
+	}
+
+	l.Observe("fast", Result{Outcome: Failed, Err: errors.New("429")})
+	if n := l.Limit("fast"); n != 4 {
+		t.Errorf("limit %d after an error, want 4", n)
+	}
+	// The rest of the round does not back off again
+	l.Observe("fast", Result{Outcome: TimedOut})
+	if n := l.Limit("fast"); n != 4 {
+		t.Errorf("limit %d after a second error in the same round, want 4", n)
+	}
+
+	// Slow successes back off too, down to Min
+	for i := 0; i < 50; i++ {
+		l.Observe("slow", Result{Outcome: Success, Duration: time.Second})
+	}
+	if n := l.Limit("slow"); n != 1 {
+		t.Errorf("slow group limit %d, want 1", n)
+	}
+	if n := l.Limit("other"); n != 2 {
+		t.Errorf("untouched group limit %d, want 2", n)
+	}
+}
+
+func TestPoolGroupLimitDoesNotStarveOtherGroups(t *testing.T) {
+	p := NewPoolWithOptions(PoolOptions{
+		Workers: 4,
+		Limiter: StaticLimiter{Limits: map[string]int{"slow": 1}},
+	})
+	defer p.Close()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	slowRunning, maxSlow := 0, 0
+	for i := 0; i < 5; i++ {
+		p.Submit(Task{Ctx: context.Background(), Group: "slow", Priority: 10, Work: func(ctx context.Context) error {
+			mu.Lock()
+			slowRunning++
+			maxSlow = max(maxSlow, slowRunning)
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			slowRunning--
+			mu.Unlock()
+			return nil
+		}})
+	}
+
+	// Lower priority tasks of another group run while the slow ones queue
+	done := make(chan struct{})
+	p.Submit(Task{Ctx: context.Background(), Group: "fast", Work: func(context.Context) error {
+		close(done)
+		return nil
+	}})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast group task starved by the slow group")
+	}
+
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if maxSlow != 1 {
+		t.Errorf("saw %d slow tasks at once, limit is 1", maxSlow)
+	}
+}
@@ -1,29 +1,129 @@
 package worker
 
 import (
+	"container/heap"
 	"context"
+	"errors"
+	"sync"
 	"time"
+
+	"github.com/olablt/gio-tiles/tiles/metrics"
+)
+
+var (
+	queueDepth = metrics.Default.Gauge("gio_tiles_pool_queue_depth", "Tasks submitted to worker pools and not started yet.")
+	running    = metrics.Default.Gauge("gio_tiles_pool_running", "Tasks running in worker pools.")
+	outcomes   = metrics.Default.Counter("gio_tiles_pool_tasks_total", "Tasks finished by worker pools, by outcome.", "outcome")
 )
 
+// DefaultTimeout bounds tasks without a Timeout of their own
+const DefaultTimeout = 10 * time.Second
+
+// ErrClosed is returned by Submit once the pool is shut down or closed
+var ErrClosed = errors.New("worker: pool closed")
+
+// Pool runs tasks on a bounded number of workers. Queued tasks are started
+// in order of decreasing Priority, and in submission order among equal
+// priorities.
 type Pool struct {
-	workers chan struct{}
-	tasks   chan Task
-	quit    chan struct{}
+	maxWorkers int
+	limiter    Limiter
+	mu         sync.Mutex
+	queue      taskQueue
+	running    int
+	// groupRunning counts running tasks per Group when there is a limiter
+	groupRunning map[string]int
+	seq          uint64
+	wake         chan struct{}
+	// closed stops Submit, draining keeps the dispatcher going until the
+	// queue is empty
+	closed   bool
+	draining bool
+	// tasks counts accepted tasks until they finish or are dropped
+	tasks  sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type Task struct {
-	Ctx      context.Context
-	Work     func() error
+	// Ctx cancels the task, whether it is queued or running. A nil Ctx
+	// never does.
+	Ctx context.Context
+	// Work does the task. Its context ends when Ctx does, when Timeout
+	// passes or when the pool is closed, and Work should return then.
+	Work func(ctx context.Context) error
+	// Timeout bounds a single run of Work, DefaultTimeout when zero
+	Timeout time.Duration
+	// Priority orders queued tasks, higher values start first
 	Priority int
+	// Key identifies the task to the function passed to Reprioritize
+	Key any
+	// Group names the resource the task uses, typically the host it
+	// fetches from. The pool's Limiter bounds the running tasks per group.
+	Group string
+	// OnResult, when set, is called once with the task's outcome, including
+	// for tasks dropped before they started
+	OnResult func(Result)
+}
+
+// Outcome tells how a task ended
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failed
+	TimedOut
+	Cancelled
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Success:
+		return "success"
+	case Failed:
+		return "error"
+	case TimedOut:
+		return "timeout"
+	case Cancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// Result reports the outcome of a task
+type Result struct {
+	Key     any
+	Outcome Outcome
+	// Err is the error returned by Work, or the reason the task did not run
+	Err error
+	// Duration is the time spent in Work
+	Duration time.Duration
+}
+
+// PoolOptions configures a Pool
+type PoolOptions struct {
+	// Workers bounds the tasks running at once across all groups
+	Workers int
+	// Limiter additionally bounds the running tasks of each Group, no
+	// per-group limit when nil
+	Limiter Limiter
 }
 
 func NewPool(maxWorkers int) *Pool {
+	return NewPoolWithOptions(PoolOptions{Workers: maxWorkers})
+}
+
+func NewPoolWithOptions(opts PoolOptions) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
 	p := &Pool{
-		workers: make(chan struct{}, maxWorkers),
-		tasks:   make(chan Task, 100),
-		quit:    make(chan struct{}),
+		maxWorkers:   opts.Workers,
+		limiter:      opts.Limiter,
+		groupRunning: make(map[string]int),
+		wake:         make(chan struct{}, 1),
+		ctx:          ctx,
+		cancel:       cancel,
 	}
-	
+
 	go p.dispatcher()
 	return p
 }
@@ -31,49 +131,269 @@ func NewPool(maxWorkers int) *Pool {
 func (p *Pool) dispatcher() {
 	for {
 		select {
-		case <-p.quit:
+		case <-p.ctx.Done():
+			p.drop()
 			return
-		case task := <-p.tasks:
-			select {
-			case p.workers <- struct{}{}:
-				go func() {
-					defer func() { <-p.workers }()
-					
-					done := make(chan error, 1)
-					go func() {
-						done <- task.Work()
-					}()
-
-					select {
-					case <-task.Ctx.Done():
-						return
-					case <-done:
-						return
-					case <-time.After(10 * time.Second):
-						return
-					}
-				}()
-			default:
-				go func() {
-					time.Sleep(100 * time.Millisecond)
-					p.Submit(task)
-				}()
+		case <-p.wake:
+		}
+
+		p.mu.Lock()
+		// Drop cancelled tasks even when no worker is free, so that
+		// whoever cancelled them does not wait for running tasks
+		cancelled := p.queue.removeCancelled()
+		// Tasks of groups at their limit wait for a later round, without
+		// holding up the tasks of other groups
+		var blocked []*queuedTask
+		for p.running < p.maxWorkers && p.queue.Len() > 0 && p.ctx.Err() == nil {
+			qt := heap.Pop(&p.queue).(*queuedTask)
+			task := qt.task
+			if task.Ctx.Err() != nil {
+				cancelled = append(cancelled, qt)
+				continue
+			}
+			if p.groupFull(task.Group) {
+				blocked = append(blocked, qt)
+				continue
+			}
+			qt.stop()
+			p.running++
+			if p.limiter != nil {
+				p.groupRunning[task.Group]++
 			}
+			queueDepth.Add(-1)
+			running.Add(1)
+			go p.run(task)
+		}
+		for _, qt := range blocked {
+			heap.Push(&p.queue, qt)
+		}
+		idle := p.draining && p.queue.Len() == 0
+		p.mu.Unlock()
+
+		queueDepth.Add(float64(-len(cancelled)))
+		for _, qt := range cancelled {
+			qt.stop()
+			// Nobody is waiting for the result anymore
+			p.finish(qt.task, Result{Outcome: Cancelled, Err: qt.task.Ctx.Err()})
+		}
+		if idle {
+			// Running tasks only need the pool to release their slots
+			return
+		}
+	}
+}
+
+// groupFull reports whether group has reached the limiter's limit
+func (p *Pool) groupFull(group string) bool {
+	if p.limiter == nil {
+		return false
+	}
+	limit := p.limiter.Limit(group)
+	return limit > 0 && p.groupRunning[group] >= limit
+}
+
+// drop discards the queued tasks
+func (p *Pool) drop() {
+	p.mu.Lock()
+	queue := p.queue
+	p.queue = nil
+	p.mu.Unlock()
+	queueDepth.Add(float64(-len(queue)))
+	for _, qt := range queue {
+		qt.stop()
+		p.finish(qt.task, Result{Outcome: Cancelled, Err: ErrClosed})
+	}
+}
+
+// finish reports the result of a task and releases it from Shutdown and
+// Close
+func (p *Pool) finish(task Task, result Result) {
+	result.Key = task.Key
+	outcomes.Inc(result.Outcome.String())
+	if task.OnResult != nil {
+		task.OnResult(result)
+	}
+	p.tasks.Done()
+}
+
+func (p *Pool) run(task Task) {
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(task.Ctx, timeout)
+	// Closing the pool cancels running tasks too
+	stop := context.AfterFunc(p.ctx, cancel)
+
+	start := time.Now()
+	err := task.Work(ctx)
+	result := Result{Err: err, Duration: time.Since(start)}
+	switch {
+	case err == nil:
+		result.Outcome = Success
+	case task.Ctx.Err() != nil:
+		result.Outcome = Cancelled
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.Outcome = TimedOut
+	case ctx.Err() != nil:
+		// The pool was closed
+		result.Outcome = Cancelled
+	default:
+		result.Outcome = Failed
+	}
+	stop()
+	cancel()
+
+	p.mu.Lock()
+	p.running--
+	if p.limiter != nil {
+		if p.groupRunning[task.Group]--; p.groupRunning[task.Group] == 0 {
+			delete(p.groupRunning, task.Group)
+		}
+		if result.Outcome != Cancelled {
+			p.limiter.Observe(task.Group, result)
 		}
 	}
+	p.mu.Unlock()
+	running.Add(-1)
+	p.finish(task, result)
+	p.signal()
 }
 
-func (p *Pool) Submit(task Task) {
+// signal wakes the dispatcher without blocking
+func (p *Pool) signal() {
 	select {
-	case p.tasks <- task:
+	case p.wake <- struct{}{}:
 	default:
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-			p.Submit(task)
-		}()
 	}
 }
 
-func (p *Pool) Shutdown() {
-	close(p.quit)
+// Submit queues a task, it returns ErrClosed once the pool is shut down
+func (p *Pool) Submit(task Task) error {
+	if task.Ctx == nil {
+		task.Ctx = context.Background()
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.tasks.Add(1)
+	p.seq++
+	heap.Push(&p.queue, &queuedTask{
+		task: task,
+		seq:  p.seq,
+		// Wake the dispatcher to drop the task when it is cancelled
+		stop: context.AfterFunc(task.Ctx, p.signal),
+	})
+	p.mu.Unlock()
+	queueDepth.Add(1)
+	p.signal()
+	return nil
+}
+
+// Reprioritize recomputes the priority of every queued task, for example
+// after the viewport moved
+func (p *Pool) Reprioritize(priority func(task Task) int) {
+	p.mu.Lock()
+	for _, qt := range p.queue {
+		qt.task.Priority = priority(qt.task)
+	}
+	heap.Init(&p.queue)
+	p.mu.Unlock()
+}
+
+// QueueDepth returns the number of submitted tasks that have not started
+func (p *Pool) QueueDepth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queue.Len()
+}
+
+// Shutdown stops accepting tasks and waits for the queued and running ones
+// to finish. If ctx ends first, the remaining tasks are aborted as by Close
+// and ctx's error is returned. Shutdown may be called more than once.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.draining = true
+	p.mu.Unlock()
+	p.signal()
+
+	done := make(chan struct{})
+	go func() {
+		p.tasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting tasks, drops the queued ones, cancels the running
+// ones and waits for them to return. Close may be called more than
+// once.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.cancel()
+	p.tasks.Wait()
+	return nil
+}
+
+type queuedTask struct {
+	task Task
+	seq  uint64
+	stop func() bool
+}
+
+// taskQueue is a max-heap on Priority, breaking ties by submission order
+type taskQueue []*queuedTask
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].task.Priority != q[j].task.Priority {
+		return q[i].task.Priority > q[j].task.Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskQueue) Push(x any) { *q = append(*q, x.(*queuedTask)) }
+
+func (q *taskQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
+
+// removeCancelled removes and returns the tasks whose Ctx is done
+func (q *taskQueue) removeCancelled() []*queuedTask {
+	var cancelled []*queuedTask
+	kept := (*q)[:0]
+	for _, qt := range *q {
+		if qt.task.Ctx.Err() != nil {
+			cancelled = append(cancelled, qt)
+		} else {
+			kept = append(kept, qt)
+		}
+	}
+	if len(cancelled) > 0 {
+		clear((*q)[len(kept):])
+		*q = kept
+		heap.Init(q)
+	}
+	return cancelled
 }
@@ -0,0 +1,278 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olablt/gio-tiles/tiles/tiletest"
+)
+
+func TestPoolLimitsConcurrency(t *testing.T) {
+	srv := tiletest.NewServer()
+	defer srv.Close()
+	srv.SetDefault(tiletest.Behavior{Latency: 20 * time.Millisecond})
+
+	const workers, tasks = 3, 12
+	p := NewPool(workers)
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(tasks)
+	for i := 0; i < tasks; i++ {
+		url := fmt.Sprintf("%s/4/%d/0.png", srv.URL, i)
+		p.Submit(Task{
+			Ctx: context.Background(),
+			Work: func(ctx context.Context) error {
+				defer wg.Done()
+				req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+				if err != nil {
+					return err
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return err
+				}
+				return resp.Body.Close()
+			},
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tasks did not finish")
+	}
+
+	if n := srv.TotalRequests(); n != tasks {
+		t.Errorf("got %d requests, want %d", n, tasks)
+	}
+	if n := srv.MaxInFlight(); n > workers {
+		t.Errorf("saw %d concurrent requests with %d workers", n, workers)
+	}
+}
+
+func TestPoolRunsHighestPriorityFirst(t *testing.T) {
+	p := NewPool(1)
+	defer p.Close()
+
+	// Occupy the only worker so that the following tasks queue up
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.Submit(Task{Ctx: context.Background(), Work: func(context.Context) error {
+		close(started)
+		<-block
+		return nil
+	}})
+	<-started
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	submit := func(key, priority int) {
+		wg.Add(1)
+		p.Submit(Task{
+			Ctx:      context.Background(),
+			Priority: priority,
+			Key:      key,
+			Work: func(context.Context) error {
+				defer wg.Done()
+				mu.Lock()
+				order = append(order, key)
+				mu.Unlock()
+				return nil
+			},
+		})
+	}
+	submit(1, 1)
+	submit(2, 5)
+	submit(3, 3)
+	submit(4, 5)
+	// Move task 1 ahead of everything else
+	p.Reprioritize(func(task Task) int {
+		if task.Key == 1 {
+			return 10
+		}
+		return task.Priority
+	})
+	if n := p.QueueDepth(); n != 4 {
+		t.Errorf("got queue depth %d, want 4", n)
+	}
+
+	close(block)
+	wg.Wait()
+	want := []int{1, 2, 4, 3}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("tasks ran in order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestPoolShutdownDrainsQueue(t *testing.T) {
+	p := NewPool(1)
+
+	var mu sync.Mutex
+	ran := 0
+	for i := 0; i < 5; i++ {
+		p.Submit(Task{Ctx: context.Background(), Work: func(context.Context) error {
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			ran++
+			mu.Unlock()
+			return nil
+		}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if ran != 5 {
+		t.Errorf("%d of 5 tasks ran before Shutdown returned", ran)
+	}
+	if err := p.Submit(Task{Ctx: context.Background(), Work: func(context.Context) error { return nil }}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit after Shutdown returned %v, want ErrClosed", err)
+	}
+	// Closing again is a no-op
+	if err := p.Shutdown(ctx); err != nil {
+		t.Errorf("second Shutdown: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Close after Shutdown: %v", err)
+	}
+}
+
+func TestPoolShutdownDeadlineAborts(t *testing.T) {
+	p := NewPool(1)
+
+	started := make(chan struct{})
+	p.Submit(Task{Ctx: context.Background(), Work: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	<-started
+	dropped := true
+	p.Submit(Task{Ctx: context.Background(), Work: func(context.Context) error {
+		dropped = false
+		return nil
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown returned %v, want DeadlineExceeded", err)
+	}
+	if !dropped {
+		t.Error("queued task ran after the deadline")
+	}
+	if n := p.QueueDepth(); n != 0 {
+		t.Errorf("got queue depth %d after abort, want 0", n)
+	}
+}
+
+func TestPoolReportsOutcomes(t *testing.T) {
+	p := NewPool(2)
+	defer p.Close()
+
+	results := make(chan Result, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	submit := func(key string, ctx context.Context, work func(context.Context) error) {
+		p.Submit(Task{
+			Ctx:      ctx,
+			Key:      key,
+			Timeout:  50 * time.Millisecond,
+			Work:     work,
+			OnResult: func(r Result) { results <- r },
+		})
+	}
+	wait := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	submit("ok", context.Background(), func(context.Context) error { return nil })
+	submit("failed", context.Background(), func(context.Context) error { return errors.New("boom") })
+	submit("timeout", context.Background(), wait)
+	submit("cancelled", ctx, wait)
+	cancel()
+
+	want := map[string]Outcome{"ok": Success, "failed": Failed, "timeout": TimedOut, "cancelled": Cancelled}
+	for range want {
+		select {
+		case r := <-results:
+			if r.Outcome != want[r.Key.(string)] {
+				t.Errorf("task %v ended with %v (%v), want %v", r.Key, r.Outcome, r.Err, want[r.Key.(string)])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing results")
+		}
+	}
+}
+
+func TestPoolWorkHoldsSlotUntilReturn(t *testing.T) {
+	const workers = 2
+	p := NewPool(workers)
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	for i := 0; i < 6; i++ {
+		p.Submit(Task{
+			Ctx:     context.Background(),
+			Timeout: 10 * time.Millisecond,
+			Work: func(ctx context.Context) error {
+				mu.Lock()
+				inFlight++
+				maxInFlight = max(maxInFlight, inFlight)
+				mu.Unlock()
+				<-ctx.Done()
+				// Slow to notice the timeout, the slot must stay taken
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				return ctx.Err()
+			},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if maxInFlight > workers {
+		t.Errorf("saw %d tasks in Work with %d workers", maxInFlight, workers)
+	}
+}
+
+func TestPoolTaskWithoutContext(t *testing.T) {
+	p := NewPool(1)
+	defer p.Close()
+	results := make(chan Result, 1)
+	err := p.Submit(Task{
+		Work:     func(ctx context.Context) error { return ctx.Err() },
+		OnResult: func(r Result) { results <- r },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-results:
+		if r.Outcome != Success {
+			t.Errorf("outcome %v, %v", r.Outcome, r.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task did not run")
+	}
+}